@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"fast-celery-ping/internal/broker"
+)
+
+// celeryCompatVersion is the Celery release whose `inspect ping` output the
+// --celery-compat formatters reproduce byte for byte
+const celeryCompatVersion = "5.3"
+
+// celeryNoReplies is what Celery prints on stderr when nobody answered
+const celeryNoReplies = "Error: No nodes replied within time constraint"
+
+// celeryFormatters replace the json and text formatters with --celery-compat
+var celeryFormatters = map[string]resultFormatter{
+	"json": formatCeleryJSON,
+	"text": formatCeleryText,
+}
+
+// celeryReplies returns the replies Celery would have printed, in arrival
+// order: workers that never replied (timeouts) are left out
+func celeryReplies(responses map[string]broker.PingResponse) []broker.PingResponse {
+	replies := make([]broker.PingResponse, 0, len(responses))
+	for _, response := range responses {
+		if response.Status != broker.StatusTimeout {
+			replies = append(replies, response)
+		}
+	}
+	sort.Slice(replies, func(i, j int) bool {
+		if replies[i].Latency != replies[j].Latency {
+			return replies[i].Latency < replies[j].Latency
+		}
+		return replies[i].WorkerName < replies[j].WorkerName
+	})
+	return replies
+}
+
+// formatCeleryJSON renders `celery inspect ping --json`: one line of
+// Python json.dumps output, e.g. {"w1@h": {"ok": "pong"}, "w2@h": {"ok": "pong"}}.
+// Like Celery, no replies prints nothing but an error on stderr.
+func formatCeleryJSON(w io.Writer, responses map[string]broker.PingResponse, took time.Duration) error {
+	replies := celeryReplies(responses)
+	if len(replies) == 0 {
+		fmt.Fprintln(os.Stderr, celeryNoReplies)
+		return nil
+	}
+
+	entries := make([]string, len(replies))
+	for i, reply := range replies {
+		key, value := "ok", reply.Status
+		if reply.Status == broker.StatusError {
+			key, value = "error", reply.Error
+		}
+		entries[i] = fmt.Sprintf("%s: {%s: %s}", pythonJSONString(reply.WorkerName), pythonJSONString(key), pythonJSONString(value))
+	}
+
+	_, err := fmt.Fprintf(w, "{%s}\n", strings.Join(entries, ", "))
+	return err
+}
+
+// formatCeleryText renders plain `celery inspect ping` output:
+//
+//	->  w1@h: OK
+//	        pong
+//
+//	1 node online.
+//
+// Like Celery, no replies prints nothing but an error on stderr.
+func formatCeleryText(w io.Writer, responses map[string]broker.PingResponse, took time.Duration) error {
+	replies := celeryReplies(responses)
+	if len(replies) == 0 {
+		fmt.Fprintln(os.Stderr, celeryNoReplies)
+		return nil
+	}
+
+	for _, reply := range replies {
+		status, body := "OK", reply.Status
+		if reply.Status == broker.StatusError {
+			status, body = "ERROR", reply.Error
+		}
+		fmt.Fprintf(w, "->  %s: %s\n        %s\n", reply.WorkerName, status, body)
+	}
+
+	noun := "nodes"
+	if len(replies) == 1 {
+		noun = "node"
+	}
+	_, err := fmt.Fprintf(w, "\n%d %s online.\n", len(replies), noun)
+	return err
+}
+
+// pythonJSONString encodes s the way Python's json.dumps does by default:
+// no HTML escaping, and every non-ASCII character as a \uXXXX escape
+func pythonJSONString(s string) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s) // encoding a string cannot fail
+
+	var out strings.Builder
+	for _, r := range strings.TrimSuffix(buf.String(), "\n") {
+		switch {
+		case r < 0x80:
+			out.WriteRune(r)
+		case r > 0xFFFF:
+			high, low := utf16.EncodeRune(r)
+			fmt.Fprintf(&out, `\u%04x\u%04x`, high, low)
+		default:
+			fmt.Fprintf(&out, `\u%04x`, r)
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"fast-celery-ping/internal/broker"
+	"fast-celery-ping/internal/config"
+)
+
+func TestOutputResults_CeleryCompat(t *testing.T) {
+	responses := map[string]broker.PingResponse{
+		"worker2@host": {WorkerName: "worker2@host", Status: "pong", Latency: 30 * time.Millisecond},
+		"worker1@host": {WorkerName: "worker1@host", Status: "pong", Latency: 10 * time.Millisecond},
+		"broken@host":  {WorkerName: "broken@host", Status: broker.StatusError, Error: "shutting down", Latency: 20 * time.Millisecond},
+		"slow@host":    {WorkerName: "slow@host", Status: broker.StatusTimeout, Error: "no reply within 1s"},
+	}
+
+	tests := []struct {
+		name         string
+		outputFormat string
+		responses    map[string]broker.PingResponse
+		expected     string
+	}{
+		{
+			name:         "json in arrival order",
+			outputFormat: "json",
+			responses:    responses,
+			expected:     `{"worker1@host": {"ok": "pong"}, "broken@host": {"error": "shutting down"}, "worker2@host": {"ok": "pong"}}` + "\n",
+		},
+		{
+			name:         "text in arrival order",
+			outputFormat: "text",
+			responses:    responses,
+			expected: "->  worker1@host: OK\n        pong\n" +
+				"->  broken@host: ERROR\n        shutting down\n" +
+				"->  worker2@host: OK\n        pong\n" +
+				"\n3 nodes online.\n",
+		},
+		{
+			name:         "text single node",
+			outputFormat: "text",
+			responses: map[string]broker.PingResponse{
+				"worker1@host": {WorkerName: "worker1@host", Status: "pong"},
+			},
+			expected: "->  worker1@host: OK\n        pong\n\n1 node online.\n",
+		},
+		{
+			name:         "json escapes like python",
+			outputFormat: "json",
+			responses: map[string]broker.PingResponse{
+				"wörker<1>@host": {WorkerName: "wörker<1>@host", Status: "pong"},
+			},
+			expected: `{"w\u00f6rker<1>@host": {"ok": "pong"}}` + "\n",
+		},
+		{
+			name:         "no replies prints nothing",
+			outputFormat: "json",
+			responses:    map[string]broker.PingResponse{},
+			expected:     "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg = &config.Config{OutputFormat: tt.outputFormat, CeleryCompat: true}
+
+			var buf bytes.Buffer
+			if err := outputResults(&buf, tt.responses, 25*time.Millisecond); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if buf.String() != tt.expected {
+				t.Errorf("Expected:\n%q\ngot:\n%q", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestPythonJSONString(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"worker@host", `"worker@host"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{"a&b", `"a&b"`},
+		{"zürich", `"z\u00fcrich"`},
+		{"🚀", `"\ud83d\ude80"`},
+	}
+
+	for _, tt := range tests {
+		if got := pythonJSONString(tt.input); got != tt.expected {
+			t.Errorf("pythonJSONString(%q) = %s, expected %s", tt.input, got, tt.expected)
+		}
+	}
+}
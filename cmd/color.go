@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/mattn/go-isatty"
+)
+
+// ANSI escape codes used to colorize text output
+const (
+	ansiReset  = "\033[0m"
+	ansiRed    = "\033[31m"
+	ansiGreen  = "\033[32m"
+	ansiYellow = "\033[33m"
+)
+
+// useColor reports whether text written to w should be colorized: only when
+// w is a terminal and color was not disabled with --no-color or NO_COLOR
+func useColor(w io.Writer) bool {
+	if cfg.NoColor {
+		return false
+	}
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	return isatty.IsTerminal(file.Fd()) || isatty.IsCygwinTerminal(file.Fd())
+}
+
+// colorize wraps s in the given ANSI color when enabled
+func colorize(enabled bool, color, s string) string {
+	if !enabled {
+		return s
+	}
+	return color + s + ansiReset
+}
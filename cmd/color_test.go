@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"fast-celery-ping/internal/broker"
+	"fast-celery-ping/internal/config"
+)
+
+func TestUseColor(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "out.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	cfg = &config.Config{}
+	if useColor(&bytes.Buffer{}) {
+		t.Error("Expected no color for a buffer")
+	}
+	if useColor(file) {
+		t.Error("Expected no color for a regular file")
+	}
+
+	cfg = &config.Config{NoColor: true}
+	if useColor(os.Stdout) {
+		t.Error("Expected --no-color to disable color")
+	}
+}
+
+func TestWriteText_Color(t *testing.T) {
+	responses := map[string]broker.PingResponse{
+		"worker1@host": {WorkerName: "worker1@host", Status: "pong"},
+	}
+
+	tests := []struct {
+		name      string
+		responses map[string]broker.PingResponse
+		color     bool
+		expected  string
+	}{
+		{
+			name:      "colored",
+			responses: responses,
+			color:     true,
+			expected:  "worker1@host: \033[32mOK pong\033[0m\n\033[32m1 nodes online.\033[0m\n",
+		},
+		{
+			name:      "plain",
+			responses: responses,
+			expected:  "worker1@host: OK pong\n1 nodes online.\n",
+		},
+		{
+			name:      "colored without replies",
+			responses: map[string]broker.PingResponse{},
+			color:     true,
+			expected:  "\033[31mError: No nodes replied within time constraint.\033[0m\n",
+		},
+		{
+			name: "colored partial",
+			responses: map[string]broker.PingResponse{
+				"worker1@host": {WorkerName: "worker1@host", Status: broker.StatusTimeout, Error: "no reply within 1s"},
+			},
+			color:    true,
+			expected: "worker1@host: \033[33mTIMEOUT no reply within 1s\033[0m\n\033[33m0 nodes online.\033[0m\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeText(&buf, tt.responses, 0, tt.color); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, buf.String())
+			}
+		})
+	}
+}
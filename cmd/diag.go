@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"fast-celery-ping/internal/broker"
+
+	"github.com/spf13/cobra"
+)
+
+// diagCmd represents the diag command
+var diagCmd = &cobra.Command{
+	Use:   "diag",
+	Short: "Print broker diagnostics, then ping the workers",
+	Long: `Connect to the broker, print what the server reports about itself
+(Redis INFO server/clients, or the AMQP server properties) and then ping the
+workers as usual. Useful when attaching details to a bug report.`,
+	RunE: runDiag,
+}
+
+func init() {
+	rootCmd.AddCommand(diagCmd)
+}
+
+// runDiag connects, prints the diagnostics and pings
+func runDiag(cmd *cobra.Command, args []string) error {
+	out, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	brokerInstance, err := broker.NewBroker(cfg.BrokerType, newBrokerConfig())
+	if err != nil {
+		return fmt.Errorf("failed to create broker: %w", err)
+	}
+
+	connectCtx, connectCancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
+	defer connectCancel()
+
+	if err := brokerInstance.Connect(connectCtx); err != nil {
+		return fmt.Errorf("failed to connect to broker: %w", err)
+	}
+	defer brokerInstance.Close()
+
+	code, err := diagnose(context.Background(), out, brokerInstance)
+	if err != nil {
+		return err
+	}
+	if code != exitOK {
+		return exitWithCode(cmd, code)
+	}
+	return nil
+}
+
+// diagnose writes the broker diagnostics followed by the ping results to w
+// and returns the ping's exit code. Diagnostics that cannot be fetched are
+// reported but do not stop the ping.
+func diagnose(ctx context.Context, w io.Writer, b broker.Broker) (int, error) {
+	info, err := b.Diagnostics(ctx)
+	formatBrokerInfo(w, cfg.BrokerType, info, err)
+	if cfg.ManagementURL != "" {
+		checkPidboxBindings(ctx, w)
+	}
+	fmt.Fprintln(w)
+
+	start := time.Now()
+	pingCtx, cancel := context.WithTimeout(ctx, cfg.Timeout+pingGracePeriod)
+	defer cancel()
+
+	responses, err := b.Ping(pingCtx, cfg.Timeout, pingDestinations())
+	if err != nil {
+		return exitBrokerError, fmt.Errorf("ping failed: %w", err)
+	}
+	responses = narrowResponses(responses)
+	if cfg.SlowThreshold > 0 {
+		markSlow(responses, cfg.SlowThreshold)
+	}
+
+	if err := outputResults(w, responses, time.Since(start)); err != nil {
+		return exitBrokerError, err
+	}
+	code := pingExitCode(responses, cfg.Destination)
+	if cfg.FailOnSlow && code == exitOK && hasSlow(responses) {
+		code = exitPartial
+	}
+	return code, nil
+}
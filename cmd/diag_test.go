@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"fast-celery-ping/internal/broker"
+	"fast-celery-ping/internal/config"
+)
+
+func TestDiagnose(t *testing.T) {
+	tests := []struct {
+		name     string
+		broker   *broker.MockBroker
+		wantCode int
+		wantOut  []string
+	}{
+		{
+			name: "diagnostics then ping results",
+			broker: &broker.MockBroker{
+				Info: map[string]string{"redis_version": "7.2.4", "connected_clients": "3"},
+				Responses: map[string]broker.PingResponse{
+					"worker1@host": {WorkerName: "worker1@host", Status: "pong"},
+				},
+			},
+			wantCode: exitOK,
+			wantOut: []string{
+				"Broker (redis):\n  connected_clients: 3\n  redis_version: 7.2.4\n\n",
+				"worker1@host: OK pong\n1 nodes online.\n",
+			},
+		},
+		{
+			name:     "diagnostics failure still pings",
+			broker:   &broker.MockBroker{ConnectErr: errors.New("INFO denied")},
+			wantCode: exitNoReplies,
+			wantOut: []string{
+				"Broker (redis): unavailable (INFO denied)\n",
+				"Error: No nodes replied within time constraint.\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg = &config.Config{BrokerType: "redis", OutputFormat: "text", Timeout: 100 * time.Millisecond}
+
+			var buf bytes.Buffer
+			code, err := diagnose(context.Background(), &buf, tt.broker)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if code != tt.wantCode {
+				t.Errorf("Expected exit code %d, got %d", tt.wantCode, code)
+			}
+
+			output := buf.String()
+			last := -1
+			for _, want := range tt.wantOut {
+				index := strings.Index(output, want)
+				if index <= last {
+					t.Errorf("Expected %q after previous output, got:\n%s", want, output)
+				}
+				last = index
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"fast-celery-ping/internal/broker"
+)
+
+// printDryRun prints the ping message b would publish, where it would go and
+// where replies would come back, without connecting. A Redis envelope's
+// base64 body is decoded as well.
+func printDryRun(w io.Writer, brokerType string, b broker.Broker, destinations []string) error {
+	previewer, ok := b.(broker.Previewer)
+	if !ok {
+		return fmt.Errorf("dry run is not supported for the %s broker", brokerType)
+	}
+
+	preview, err := previewer.PreviewPing(destinations)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Broker:   %s\n", brokerType)
+	fmt.Fprintf(w, "Publish:  %s\n", preview.Target)
+	fmt.Fprintf(w, "Reply to: %s\n", preview.ReplyTo)
+	fmt.Fprintf(w, "Message:\n%s\n", indentJSON(preview.Body))
+
+	var envelope struct {
+		Body string `json:"body"`
+	}
+	if json.Unmarshal(preview.Body, &envelope) == nil && envelope.Body != "" {
+		if body, err := base64.StdEncoding.DecodeString(envelope.Body); err == nil {
+			fmt.Fprintf(w, "Decoded body:\n%s\n", indentJSON(body))
+		}
+	}
+	return nil
+}
+
+// indentJSON pretty-prints data, or returns it unchanged if it is not JSON
+func indentJSON(data []byte) []byte {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return data
+	}
+	return buf.Bytes()
+}
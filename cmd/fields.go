@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"fast-celery-ping/internal/broker"
+)
+
+// formatFields renders only the --fields columns, in the order given: a
+// table for text output, or a list of objects with those keys for JSON.
+// Workers are sorted by name.
+func formatFields(w io.Writer, responses map[string]broker.PingResponse, fields []string, took time.Duration) error {
+	names := make([]string, 0, len(responses))
+	for name := range responses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if cfg.OutputFormat == "json" {
+		rows := make([]fieldRow, len(names))
+		for i, name := range names {
+			rows[i] = fieldRow{fields: fields, response: responses[name]}
+		}
+		output, err := marshalIndentJSON(rows)
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		fmt.Fprintln(w, string(output))
+		return nil
+	}
+
+	if len(responses) == 0 {
+		fmt.Fprintln(w, "Error: No nodes replied within time constraint.")
+		printTook(w, took)
+		return nil
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, strings.ToUpper(strings.Join(fields, "\t")))
+	online := 0
+	for _, name := range names {
+		response := responses[name]
+		if response.Healthy() {
+			online++
+		}
+		values := make([]string, len(fields))
+		for i, field := range fields {
+			values[i] = orDash(fieldText(response, field))
+		}
+		fmt.Fprintln(table, strings.Join(values, "\t"))
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%d nodes online.\n", online)
+	printTook(w, took)
+
+	return nil
+}
+
+// fieldRow marshals one worker as a JSON object holding fields, in order
+type fieldRow struct {
+	fields   []string
+	response broker.PingResponse
+}
+
+func (r fieldRow) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range r.fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		value, err := marshalJSON(fieldValue(r.response, field))
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, "%q:%s", field, value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// fieldValue is the JSON value of one of config.SupportedFields; latency is
+// in milliseconds
+func fieldValue(response broker.PingResponse, field string) interface{} {
+	switch field {
+	case "worker":
+		return response.WorkerName
+	case "status":
+		return displayStatus(response)
+	case "latency":
+		return response.Latency.Milliseconds()
+	case "meta":
+		return response.Meta
+	case "error":
+		return response.Error
+	}
+	return nil
+}
+
+// fieldText is the table cell of one of config.SupportedFields; meta is
+// rendered as compact JSON
+func fieldText(response broker.PingResponse, field string) string {
+	switch field {
+	case "latency":
+		if response.Latency == 0 {
+			return ""
+		}
+		return response.Latency.Round(time.Millisecond).String()
+	case "meta":
+		if len(response.Meta) == 0 {
+			return ""
+		}
+		meta, err := marshalJSON(response.Meta)
+		if err != nil {
+			return ""
+		}
+		return string(meta)
+	}
+	value, _ := fieldValue(response, field).(string)
+	return value
+}
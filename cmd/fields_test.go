@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"fast-celery-ping/internal/broker"
+	"fast-celery-ping/internal/config"
+)
+
+func TestFormatFields(t *testing.T) {
+	responses := map[string]broker.PingResponse{
+		"w2@h": {WorkerName: "w2@h", Status: broker.StatusError, Error: "shutting down"},
+		"w1@h": {
+			WorkerName: "w1@h",
+			Status:     "pong",
+			Latency:    12 * time.Millisecond,
+			Meta:       map[string]interface{}{"sw_ver": "5.3.0"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		format   string
+		fields   []string
+		expected string
+	}{
+		{
+			name:   "json keeps field order",
+			format: "json",
+			fields: []string{"worker", "latency", "meta"},
+			expected: `[
+  {
+    "worker": "w1@h",
+    "latency": 12,
+    "meta": {
+      "sw_ver": "5.3.0"
+    }
+  },
+  {
+    "worker": "w2@h",
+    "latency": 0,
+    "meta": null
+  }
+]
+`,
+		},
+		{
+			name:     "json names only",
+			format:   "json",
+			fields:   []string{"worker"},
+			expected: "[\n  {\n    \"worker\": \"w1@h\"\n  },\n  {\n    \"worker\": \"w2@h\"\n  }\n]\n",
+		},
+		{
+			name:   "text table",
+			format: "text",
+			fields: []string{"status", "worker", "latency", "error"},
+			expected: "STATUS  WORKER  LATENCY  ERROR\n" +
+				"pong    w1@h    12ms     -\n" +
+				"error   w2@h    -        shutting down\n" +
+				"1 nodes online.\n" +
+				"took 1.5s\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg = &config.Config{OutputFormat: tt.format, Fields: tt.fields}
+
+			var buf bytes.Buffer
+			if err := outputResults(&buf, responses, 1500*time.Millisecond); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestFormatFields_Empty(t *testing.T) {
+	for format, expected := range map[string]string{
+		"json": "[]\n",
+		"text": "Error: No nodes replied within time constraint.\n",
+	} {
+		cfg = &config.Config{OutputFormat: format, Fields: []string{"worker"}}
+
+		var buf bytes.Buffer
+		if err := outputResults(&buf, nil, 0); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if buf.String() != expected {
+			t.Errorf("Expected %q for %s, got %q", expected, format, buf.String())
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"fast-celery-ping/internal/broker"
+	"fast-celery-ping/internal/protocol"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var aggregateStats bool
+
+// inspectCmd represents the inspect command
+var inspectCmd = &cobra.Command{
+	Use:   "inspect",
+	Short: "Show worker details from Celery's stats command",
+	Long: `Send Celery's "stats" control command and show what each worker reports:
+pid, tasks processed, load average and software identity where present.
+
+Text output is a table; json and yaml print the same fields per worker.
+"inspect stats --aggregate" sums them into cluster-wide totals.`,
+	RunE: runInspect,
+}
+
+// inspectStatsCmd represents the inspect stats command
+var inspectStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show worker stats, or cluster-wide totals with --aggregate",
+	Long: `Send Celery's "stats" control command and show what each worker reports,
+as plain inspect does.
+
+With --aggregate the replies are summed into cluster-wide totals instead:
+workers that replied, tasks processed, pool processes and pool concurrency.`,
+	RunE: runInspect,
+}
+
+func init() {
+	inspectStatsCmd.Flags().BoolVar(&aggregateStats, "aggregate", false, "Print cluster-wide totals instead of one entry per worker")
+	inspectCmd.AddCommand(inspectStatsCmd)
+	rootCmd.AddCommand(inspectCmd)
+}
+
+// runInspect connects, collects the stats replies and renders them, per
+// worker or aggregated
+func runInspect(cmd *cobra.Command, args []string) error {
+	out, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	brokerInstance, err := broker.NewBroker(cfg.BrokerType, newBrokerConfig())
+	if err != nil {
+		return fmt.Errorf("failed to create broker: %w", err)
+	}
+
+	connectCtx, connectCancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
+	defer connectCancel()
+
+	if err := brokerInstance.Connect(connectCtx); err != nil {
+		return fmt.Errorf("failed to connect to broker: %w", err)
+	}
+	defer brokerInstance.Close()
+
+	workers, err := inspectWorkers(context.Background(), brokerInstance, cfg.Timeout, pingDestinations())
+	if err != nil {
+		return err
+	}
+	if aggregateStats {
+		return formatClusterStats(out, cfg.OutputFormat, aggregateWorkerInfo(workers))
+	}
+	return formatWorkerInfo(out, cfg.OutputFormat, workers)
+}
+
+// inspectWorkers sends "stats" and parses every reply into a WorkerInfo.
+// Replies that cannot be parsed are skipped.
+func inspectWorkers(ctx context.Context, b broker.Broker, timeout time.Duration, destinations []string) (map[string]protocol.WorkerInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout+pingGracePeriod)
+	defer cancel()
+
+	replies, err := b.Inspect(ctx, "stats", timeout, destinations)
+	if err != nil {
+		return nil, fmt.Errorf("inspect failed: %w", err)
+	}
+
+	now := time.Now().UTC()
+	workers := make(map[string]protocol.WorkerInfo, len(replies))
+	for name, reply := range replies {
+		info, err := protocol.ParseWorkerInfo(name, reply)
+		if err != nil {
+			continue
+		}
+		info.Timestamp = now
+		workers[name] = info
+	}
+	return filterWorkerInfo(workers), nil
+}
+
+// filterWorkerInfo drops the workers that were not asked for, like
+// narrowResponses does for ping replies
+func filterWorkerInfo(workers map[string]protocol.WorkerInfo) map[string]protocol.WorkerInfo {
+	for name := range workers {
+		if matchesAny(name, cfg.Exclude) || (len(cfg.DestinationGlobs) > 0 && !destinationMatches(name)) {
+			delete(workers, name)
+		}
+	}
+	return workers
+}
+
+// formatWorkerInfo renders worker details as a table (text), JSON or YAML
+func formatWorkerInfo(w io.Writer, format string, workers map[string]protocol.WorkerInfo) error {
+	switch format {
+	case "json":
+		output, err := marshalIndentJSON(workers)
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		fmt.Fprintln(w, string(output))
+		return nil
+	case "yaml":
+		output, err := yaml.Marshal(workers)
+		if err != nil {
+			return fmt.Errorf("failed to marshal YAML: %w", err)
+		}
+		_, err = w.Write(output)
+		return err
+	case "text":
+		return formatWorkerTable(w, workers)
+	default:
+		return fmt.Errorf("inspect does not support %s output (use text, json or yaml)", format)
+	}
+}
+
+// formatWorkerTable renders one row per worker, sorted by name; fields a
+// worker did not report are shown as "-"
+func formatWorkerTable(w io.Writer, workers map[string]protocol.WorkerInfo) error {
+	if len(workers) == 0 {
+		fmt.Fprintln(w, "Error: No nodes replied within time constraint.")
+		return nil
+	}
+
+	names := make([]string, 0, len(workers))
+	for name := range workers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "WORKER\tPID\tPROCESSED\tLOADAVG\tSOFTWARE\tSYSTEM")
+	for _, name := range names {
+		info := workers[name]
+		software := strings.TrimSpace(info.SWIdent + " " + info.SWVer)
+
+		pid := ""
+		if info.PID != 0 {
+			pid = strconv.Itoa(info.PID)
+		}
+
+		loadAvg := make([]string, len(info.LoadAvg))
+		for i, load := range info.LoadAvg {
+			loadAvg[i] = strconv.FormatFloat(load, 'f', 2, 64)
+		}
+
+		fmt.Fprintf(table, "%s\t%s\t%d\t%s\t%s\t%s\n", name, orDash(pid), info.Processed, orDash(strings.Join(loadAvg, " ")), orDash(software), orDash(info.SWSys))
+	}
+	return table.Flush()
+}
+
+// clusterStats is the --aggregate reduction of the workers' stats replies
+type clusterStats struct {
+	Workers     int `json:"workers" yaml:"workers"`
+	Processed   int `json:"processed" yaml:"processed"`
+	Processes   int `json:"processes" yaml:"processes"`
+	Concurrency int `json:"concurrency" yaml:"concurrency"`
+}
+
+// aggregateWorkerInfo sums the numeric stats over all workers; fields a
+// worker did not report count as zero
+func aggregateWorkerInfo(workers map[string]protocol.WorkerInfo) clusterStats {
+	stats := clusterStats{Workers: len(workers)}
+	for _, info := range workers {
+		stats.Processed += info.Processed
+		stats.Processes += info.Processes
+		stats.Concurrency += info.Concurrency
+	}
+	return stats
+}
+
+// formatClusterStats renders the totals as a one-row table (text), JSON or
+// YAML
+func formatClusterStats(w io.Writer, format string, stats clusterStats) error {
+	switch format {
+	case "json":
+		output, err := marshalIndentJSON(stats)
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		fmt.Fprintln(w, string(output))
+		return nil
+	case "yaml":
+		output, err := yaml.Marshal(stats)
+		if err != nil {
+			return fmt.Errorf("failed to marshal YAML: %w", err)
+		}
+		_, err = w.Write(output)
+		return err
+	case "text":
+		if stats.Workers == 0 {
+			fmt.Fprintln(w, "Error: No nodes replied within time constraint.")
+			return nil
+		}
+		table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "WORKERS\tPROCESSED\tPROCESSES\tCONCURRENCY")
+		fmt.Fprintf(table, "%d\t%d\t%d\t%d\n", stats.Workers, stats.Processed, stats.Processes, stats.Concurrency)
+		return table.Flush()
+	default:
+		return fmt.Errorf("inspect does not support %s output (use text, json or yaml)", format)
+	}
+}
+
+// orDash returns value, or "-" when it is empty
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
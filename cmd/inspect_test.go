@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"fast-celery-ping/internal/broker"
+	"fast-celery-ping/internal/config"
+	"fast-celery-ping/internal/protocol"
+)
+
+func TestInspectWorkers(t *testing.T) {
+	cfg = &config.Config{Exclude: []string{"debug-*"}}
+	mock := &broker.MockBroker{InspectReplies: map[string]json.RawMessage{
+		"celery@web1":  json.RawMessage(`{"pid": 101, "total": {"tasks.add": 3}}`),
+		"celery@web2":  json.RawMessage(`not json`),
+		"debug-1@web1": json.RawMessage(`{"pid": 7}`),
+	}}
+
+	workers, err := inspectWorkers(context.Background(), mock, time.Second, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(workers) != 1 {
+		t.Fatalf("Expected only the parseable, non-excluded worker, got %v", workers)
+	}
+	info := workers["celery@web1"]
+	if info.PID != 101 || info.Processed != 3 || info.Timestamp.IsZero() {
+		t.Errorf("Unexpected worker info: %+v", info)
+	}
+}
+
+func TestFormatWorkerInfo(t *testing.T) {
+	workers := map[string]protocol.WorkerInfo{
+		"celery@web2": {Hostname: "celery@web2", Active: true, Processed: 15, PID: 4242},
+		"celery@web1": {
+			Hostname:  "celery@web1",
+			Active:    true,
+			Processed: 3,
+			PID:       101,
+			LoadAvg:   []float64{0.5, 0.25, 0.1},
+			SWIdent:   "py-celery",
+			SWVer:     "5.3.6",
+			SWSys:     "Linux",
+		},
+	}
+
+	tests := []struct {
+		name     string
+		format   string
+		workers  map[string]protocol.WorkerInfo
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:    "text table",
+			format:  "text",
+			workers: workers,
+			expected: "WORKER       PID   PROCESSED  LOADAVG         SOFTWARE         SYSTEM\n" +
+				"celery@web1  101   3          0.50 0.25 0.10  py-celery 5.3.6  Linux\n" +
+				"celery@web2  4242  15         -               -                -\n",
+		},
+		{
+			name:     "text without replies",
+			format:   "text",
+			workers:  map[string]protocol.WorkerInfo{},
+			expected: "Error: No nodes replied within time constraint.\n",
+		},
+		{
+			name:    "csv is not supported",
+			format:  "csv",
+			workers: workers,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := formatWorkerInfo(&buf, tt.format, tt.workers)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, buf.String())
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := formatWorkerInfo(&buf, "json", workers); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"sw_ver": "5.3.6"`) || !strings.Contains(buf.String(), `"pid": 4242`) {
+		t.Errorf("Expected worker fields in JSON, got %s", buf.String())
+	}
+}
+
+func TestAggregateWorkerInfo(t *testing.T) {
+	cfg = &config.Config{}
+	mock := &broker.MockBroker{InspectReplies: map[string]json.RawMessage{
+		"celery@web1": json.RawMessage(`{"pid": 101, "total": {"tasks.add": 3, "tasks.mul": 4},
+			"pool": {"implementation": "celery.concurrency.prefork:TaskPool", "max-concurrency": 4,
+				"processes": [102, 103, 104, 105], "timeouts": [0, 0]},
+			"rusage": {"utime": 1.5}, "prefetch_count": 16}`),
+		"celery@web2": json.RawMessage(`{"pid": 201, "total": {"tasks.add": 10},
+			"pool": {"implementation": "celery.concurrency.thread:TaskPool", "max-concurrency": 8}}`),
+		"celery@web3": json.RawMessage(`{"pid": 301}`),
+	}}
+
+	workers, err := inspectWorkers(context.Background(), mock, time.Second, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := clusterStats{Workers: 3, Processed: 17, Processes: 4, Concurrency: 12}
+	if got := aggregateWorkerInfo(workers); got != expected {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+	if got := aggregateWorkerInfo(nil); got != (clusterStats{}) {
+		t.Errorf("Expected zero totals without workers, got %+v", got)
+	}
+}
+
+func TestFormatClusterStats(t *testing.T) {
+	stats := clusterStats{Workers: 3, Processed: 17, Processes: 4, Concurrency: 12}
+
+	tests := []struct {
+		name     string
+		format   string
+		stats    clusterStats
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:   "text table",
+			format: "text",
+			stats:  stats,
+			expected: "WORKERS  PROCESSED  PROCESSES  CONCURRENCY\n" +
+				"3        17         4          12\n",
+		},
+		{
+			name:     "text without replies",
+			format:   "text",
+			expected: "Error: No nodes replied within time constraint.\n",
+		},
+		{
+			name:     "json",
+			format:   "json",
+			stats:    stats,
+			expected: "{\n  \"workers\": 3,\n  \"processed\": 17,\n  \"processes\": 4,\n  \"concurrency\": 12\n}\n",
+		},
+		{
+			name:     "yaml",
+			format:   "yaml",
+			stats:    stats,
+			expected: "workers: 3\nprocessed: 17\nprocesses: 4\nconcurrency: 12\n",
+		},
+		{
+			name:    "csv is not supported",
+			format:  "csv",
+			stats:   stats,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := formatClusterStats(&buf, tt.format, tt.stats)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, buf.String())
+			}
+		})
+	}
+}
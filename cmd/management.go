@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"fast-celery-ping/internal/management"
+	"fast-celery-ping/internal/protocol"
+)
+
+// checkPidboxBindings asks the RabbitMQ management API at cfg.ManagementURL
+// how many queues are bound to the pidbox exchange and writes the count to
+// w, warning when there are none. The check is advisory: failures are
+// written to w too and the ping goes ahead.
+func checkPidboxBindings(ctx context.Context, w io.Writer) {
+	exchange := cfg.PidboxChannel
+	if exchange == "" {
+		exchange = protocol.DefaultPidboxExchange
+	}
+	vhost := management.VHost(cfg.BrokerURL, cfg.VHost)
+
+	client, err := management.NewClient(cfg.ManagementURL, cfg.BrokerURL, cfg.ConnectTimeout)
+	if err != nil {
+		fmt.Fprintf(w, "Warning: management API check skipped: %v\n", err)
+		return
+	}
+
+	queues, err := client.BoundQueues(ctx, vhost, exchange)
+	if err != nil {
+		fmt.Fprintf(w, "Warning: management API check failed: %v\n", err)
+		return
+	}
+	if len(queues) == 0 {
+		fmt.Fprintf(w, "Warning: no queues are bound to %s in vhost %s; no workers will answer\n", exchange, vhost)
+		return
+	}
+
+	fmt.Fprintf(w, "%d worker queues bound to %s in vhost %s\n", len(queues), exchange, vhost)
+	if cfg.Verbose {
+		for _, queue := range queues {
+			fmt.Fprintf(w, "  %s\n", queue)
+		}
+	}
+}
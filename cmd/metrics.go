@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fast-celery-ping/internal/broker"
+)
+
+// defaultMetricsWindow is how far back the rolling success ratio looks
+const defaultMetricsWindow = 5 * time.Minute
+
+// pingOutcome is one ping handled by the server
+type pingOutcome struct {
+	at time.Time
+	ok bool
+}
+
+// pingMetrics keeps the in-memory counters exposed on /metrics. A ping counts
+// as successful when the broker answered and at least one worker replied.
+type pingMetrics struct {
+	mu          sync.Mutex
+	window      time.Duration
+	now         func() time.Time
+	total       int
+	successful  int
+	lastSuccess time.Time
+	lastSeen    map[string]time.Time
+	// recent holds the outcomes inside window, oldest first
+	recent []pingOutcome
+}
+
+func newPingMetrics(window time.Duration) *pingMetrics {
+	return &pingMetrics{
+		window:   window,
+		now:      time.Now,
+		lastSeen: make(map[string]time.Time),
+	}
+}
+
+// record counts one ping and notes when each replying worker was last seen
+func (m *pingMetrics) record(responses map[string]broker.PingResponse, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	ok := err == nil && len(responses) > 0
+
+	m.total++
+	if ok {
+		m.successful++
+		m.lastSuccess = now
+	}
+	for name := range responses {
+		m.lastSeen[name] = now
+	}
+
+	m.recent = append(m.recent, pingOutcome{at: now, ok: ok})
+	m.prune(now)
+}
+
+// prune drops outcomes that fell out of the rolling window
+func (m *pingMetrics) prune(now time.Time) {
+	cutoff := now.Add(-m.window)
+	drop := 0
+	for drop < len(m.recent) && !m.recent[drop].at.After(cutoff) {
+		drop++
+	}
+	m.recent = m.recent[drop:]
+}
+
+// successRatio is the share of successful pings inside the window, 0 if none
+func (m *pingMetrics) successRatio() float64 {
+	if len(m.recent) == 0 {
+		return 0
+	}
+	ok := 0
+	for _, outcome := range m.recent {
+		if outcome.ok {
+			ok++
+		}
+	}
+	return float64(ok) / float64(len(m.recent))
+}
+
+// writeTo writes the metrics in the Prometheus text exposition format
+func (m *pingMetrics) writeTo(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune(m.now())
+
+	writeMetric(w, "celery_ping_total", "counter", "Pings handled by the server.", float64(m.total))
+	writeMetric(w, "celery_ping_success_total", "counter", "Pings that got at least one worker reply.", float64(m.successful))
+
+	lastSuccess := 0.0
+	if !m.lastSuccess.IsZero() {
+		lastSuccess = unixSeconds(m.lastSuccess)
+	}
+	writeMetric(w, "celery_ping_last_success_timestamp_seconds", "gauge", "Unix time of the last successful ping.", lastSuccess)
+	writeMetric(w, "celery_ping_success_ratio", "gauge",
+		fmt.Sprintf("Share of successful pings over the last %s.", m.window), m.successRatio())
+
+	names := make([]string, 0, len(m.lastSeen))
+	for name := range m.lastSeen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "# HELP celery_worker_last_seen_timestamp Unix time a worker last replied to a ping.")
+	fmt.Fprintln(w, "# TYPE celery_worker_last_seen_timestamp gauge")
+	for _, name := range names {
+		fmt.Fprintf(w, "celery_worker_last_seen_timestamp{worker=\"%s\"} %s\n", escapeLabel(name), formatSample(unixSeconds(m.lastSeen[name])))
+	}
+}
+
+// writeMetric writes one unlabelled sample with its HELP and TYPE lines
+func writeMetric(w io.Writer, name, kind, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", name, help, name, kind, name, formatSample(value))
+}
+
+// formatSample writes value without an exponent, so timestamps stay readable
+func formatSample(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// unixSeconds is t as fractional Unix seconds, the Prometheus convention
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixMilli()) / 1000
+}
+
+// labelEscaper escapes label values as the exposition format requires
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"fast-celery-ping/internal/broker"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultMonitorDuration is how long monitor watches unless told otherwise
+const defaultMonitorDuration = 30 * time.Second
+
+var monitorDuration time.Duration
+
+// monitorCmd represents the monitor command
+var monitorCmd = &cobra.Command{
+	Use:   "monitor",
+	Short: "Watch the control messages on the pidbox without sending any",
+	Long: `Passively print the control messages (pings, inspect commands, ...) that
+other clients send to the workers, for --duration or until interrupted.
+Nothing is published, so the workers are not disturbed.
+
+With Redis the pidbox channel is subscribed to; with AMQP a temporary queue
+is bound to the pidbox exchange. Replies go to per-request queues and are
+not seen. Text output is one line per message; json prints one object per
+line.`,
+	RunE: runMonitor,
+}
+
+func init() {
+	monitorCmd.Flags().DurationVar(&monitorDuration, "duration", defaultMonitorDuration, "How long to watch")
+	rootCmd.AddCommand(monitorCmd)
+}
+
+// runMonitor connects and prints the control traffic until the duration
+// elapses or SIGINT/SIGTERM arrives
+func runMonitor(cmd *cobra.Command, args []string) error {
+	if monitorDuration <= 0 {
+		return fmt.Errorf("monitor duration must be positive")
+	}
+	if cfg.OutputFormat != "json" && cfg.OutputFormat != "text" {
+		return fmt.Errorf("monitor output is only available for the json and text formats")
+	}
+
+	out, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	brokerInstance, err := broker.NewBroker(cfg.BrokerType, newBrokerConfig())
+	if err != nil {
+		return fmt.Errorf("failed to create broker: %w", err)
+	}
+
+	connectCtx, connectCancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
+	defer connectCancel()
+
+	if err := brokerInstance.Connect(connectCtx); err != nil {
+		return fmt.Errorf("failed to connect to broker: %w", err)
+	}
+	defer brokerInstance.Close()
+
+	signalCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(signalCtx, monitorDuration)
+	defer cancel()
+
+	if cfg.Verbose {
+		fmt.Fprintf(os.Stderr, "Watching control messages for %v...\n", monitorDuration)
+	}
+	start := time.Now()
+	seen, err := monitorControl(ctx, out, brokerInstance)
+	if err != nil {
+		return err
+	}
+	if cfg.OutputFormat == "text" {
+		fmt.Fprintf(out, "%d control messages in %v\n", seen, time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
+
+// monitorControl prints every control message b sees until ctx is done and
+// returns how many were printed
+func monitorControl(ctx context.Context, w io.Writer, b broker.Broker) (int, error) {
+	monitor, ok := b.(broker.Monitor)
+	if !ok {
+		return 0, fmt.Errorf("monitor is not supported for the %s broker", cfg.BrokerType)
+	}
+
+	seen := 0
+	err := monitor.Monitor(ctx, func(event broker.ControlEvent) {
+		seen++
+		writeControlEvent(w, cfg.OutputFormat, event)
+	})
+	if err != nil {
+		return seen, fmt.Errorf("monitor failed: %w", err)
+	}
+	return seen, nil
+}
+
+// writeControlEvent prints one control message: a JSON object per line, or
+// a text line such as
+// "12:00:01.250 ping to all workers (reply to 3f2b..., ticket 9c1d...)"
+func writeControlEvent(w io.Writer, format string, event broker.ControlEvent) {
+	if format == "json" {
+		line, err := marshalJSON(map[string]interface{}{
+			"time":    event.Received.UTC().Format(time.RFC3339Nano),
+			"source":  event.Source,
+			"message": event.Message,
+		})
+		if err != nil {
+			fmt.Fprintf(w, "{\"error\": %q}\n", err.Error())
+			return
+		}
+		fmt.Fprintln(w, string(line))
+		return
+	}
+
+	at := event.Received.Format("15:04:05.000")
+	method, ok := event.Message["method"].(string)
+	if !ok {
+		raw, _ := marshalJSON(event.Message)
+		fmt.Fprintf(w, "%s %s\n", at, raw)
+		return
+	}
+
+	target := "all workers"
+	if destinations, ok := event.Message["destination"].([]interface{}); ok && len(destinations) > 0 {
+		names := make([]string, len(destinations))
+		for i, destination := range destinations {
+			names[i] = fmt.Sprint(destination)
+		}
+		target = strings.Join(names, ", ")
+	}
+
+	replyTo := "-"
+	if reply, ok := event.Message["reply_to"].(map[string]interface{}); ok {
+		if key, ok := reply["routing_key"].(string); ok && key != "" {
+			replyTo = key
+		}
+	}
+	ticket, _ := event.Message["ticket"].(string)
+
+	fmt.Fprintf(w, "%s %s to %s (reply to %s, ticket %s)\n", at, method, target, replyTo, orDash(ticket))
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"fast-celery-ping/internal/broker"
+	"fast-celery-ping/internal/config"
+)
+
+// stubMonitor replays events as if they were seen on the pidbox
+type stubMonitor struct {
+	stubBroker
+	events []broker.ControlEvent
+}
+
+func (s *stubMonitor) Monitor(ctx context.Context, handle func(broker.ControlEvent)) error {
+	for _, event := range s.events {
+		handle(event)
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func TestMonitorControl(t *testing.T) {
+	received := time.Date(2026, 1, 2, 12, 0, 1, 250_000_000, time.UTC)
+	events := []broker.ControlEvent{
+		{
+			Source:   "/0.celery.pidbox",
+			Received: received,
+			Message: map[string]interface{}{
+				"method":      "ping",
+				"destination": nil,
+				"ticket":      "t-1",
+				"reply_to":    map[string]interface{}{"exchange": "reply.celery.pidbox", "routing_key": "q-1"},
+			},
+		},
+		{
+			Source:   "/0.celery.pidbox",
+			Received: received,
+			Message: map[string]interface{}{
+				"method":      "stats",
+				"destination": []interface{}{"w1@h", "w2@h"},
+			},
+		},
+		{
+			Source:   "/0.celery.pidbox",
+			Received: received,
+			Message:  map[string]interface{}{"w1@h": map[string]interface{}{"ok": "pong"}},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		format   string
+		expected []string
+	}{
+		{
+			name:   "text",
+			format: "text",
+			expected: []string{
+				"12:00:01.250 ping to all workers (reply to q-1, ticket t-1)",
+				"12:00:01.250 stats to w1@h, w2@h (reply to -, ticket -)",
+				`12:00:01.250 {"w1@h":{"ok":"pong"}}`,
+			},
+		},
+		{
+			name:   "json lines",
+			format: "json",
+			expected: []string{
+				`{"message":{"destination":null,"method":"ping","reply_to":{"exchange":"reply.celery.pidbox","routing_key":"q-1"},"ticket":"t-1"},"source":"/0.celery.pidbox","time":"2026-01-02T12:00:01.25Z"}`,
+				`{"message":{"destination":["w1@h","w2@h"],"method":"stats"},"source":"/0.celery.pidbox","time":"2026-01-02T12:00:01.25Z"}`,
+				`{"message":{"w1@h":{"ok":"pong"}},"source":"/0.celery.pidbox","time":"2026-01-02T12:00:01.25Z"}`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg = &config.Config{OutputFormat: tt.format}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			var buf bytes.Buffer
+			seen, err := monitorControl(ctx, &buf, &stubMonitor{events: events})
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if seen != len(events) {
+				t.Errorf("Expected %d messages, got %d", len(events), seen)
+			}
+
+			lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+			if len(lines) != len(tt.expected) {
+				t.Fatalf("Expected %d lines, got %q", len(tt.expected), buf.String())
+			}
+			for i, line := range lines {
+				if line != tt.expected[i] {
+					t.Errorf("Line %d: expected %s, got %s", i, tt.expected[i], line)
+				}
+				if tt.format == "json" && !json.Valid([]byte(line)) {
+					t.Errorf("Line %d is not valid JSON: %s", i, line)
+				}
+			}
+		})
+	}
+}
+
+func TestMonitorControl_Unsupported(t *testing.T) {
+	cfg = &config.Config{OutputFormat: "text", BrokerType: "mock"}
+
+	_, err := monitorControl(context.Background(), &bytes.Buffer{}, &stubBroker{})
+	if err == nil || !strings.Contains(err.Error(), "monitor is not supported for the mock broker") {
+		t.Errorf("Expected unsupported broker error, got %v", err)
+	}
+}
@@ -0,0 +1,416 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"fast-celery-ping/internal/broker"
+	"fast-celery-ping/internal/config"
+
+	"gopkg.in/yaml.v3"
+)
+
+// resultFormatter renders ping results, including the empty result, to w.
+// took is the end-to-end duration of the ping; zero leaves it out.
+type resultFormatter func(w io.Writer, responses map[string]broker.PingResponse, took time.Duration) error
+
+// formatters maps each of config.SupportedOutputFormats to its formatter
+var formatters = map[string]resultFormatter{
+	"json": formatJSON,
+	"text": formatText,
+	"csv":  formatCSV,
+	"yaml": formatYAML,
+}
+
+// openOutput returns the writer results go to: the configured output file
+// (created or truncated) or stdout
+func openOutput() (io.Writer, func() error, error) {
+	if cfg.OutputFile == "" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+
+	file, err := os.Create(cfg.OutputFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open output file: %w", err)
+	}
+	return file, file.Close, nil
+}
+
+// openPingOutput is openOutput for a ping, except that check mode, whose
+// exit code is the only output, leaves --output-file untouched
+func openPingOutput() (io.Writer, func() error, error) {
+	if cfg.CheckOnly {
+		return io.Discard, func() error { return nil }, nil
+	}
+	return openOutput()
+}
+
+// marshalIndentJSON is json.MarshalIndent with two-space indentation that
+// leaves <, > and & alone, since output is not embedded in HTML; worker
+// names are printed as they are
+func marshalIndentJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// marshalJSON is the single-line marshalIndentJSON
+func marshalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// outputResults formats the ping results and writes them to w. It never
+// exits the process; deciding the exit code is up to the caller.
+func outputResults(w io.Writer, responses map[string]broker.PingResponse, took time.Duration) error {
+	if !config.IsSupportedOutputFormat(cfg.OutputFormat) {
+		return fmt.Errorf("unsupported output format: %s", cfg.OutputFormat)
+	}
+	if cfg.FormatTemplate != "" {
+		return formatTemplate(w, responses, cfg.FormatTemplate, took)
+	}
+	if cfg.IncludeOffline {
+		return formatWorkerStatus(w, responses, cfg.Destination)
+	}
+	if cfg.SummaryOnly {
+		return formatSummary(w, responses, cfg.Destination, cfg.OutputFormat == "json")
+	}
+	if len(cfg.Fields) > 0 {
+		return formatFields(w, responses, cfg.Fields, took)
+	}
+	registry := formatters
+	if cfg.CeleryCompat {
+		registry = celeryFormatters
+	}
+	formatter, ok := registry[cfg.OutputFormat]
+	if !ok {
+		return fmt.Errorf("no formatter for output format: %s", cfg.OutputFormat)
+	}
+
+	return formatter(w, responses, took)
+}
+
+// outputConsole writes the --console-format rendering of the results to w,
+// the terminal copy next to the --output-file one written by outputResults
+func outputConsole(w io.Writer, responses map[string]broker.PingResponse, took time.Duration) error {
+	switch cfg.ConsoleFormat {
+	case "summary":
+		return formatSummary(w, responses, cfg.Destination, false)
+	case "text":
+		return formatText(w, responses, took)
+	}
+	return fmt.Errorf("unsupported console format: %s", cfg.ConsoleFormat)
+}
+
+// formatJSON renders Celery-compatible JSON; no replies is an empty object.
+// With --json-envelope the worker map is wrapped together with a summary.
+func formatJSON(w io.Writer, responses map[string]broker.PingResponse, took time.Duration) error {
+	var result interface{} = resultMap(responses)
+	if cfg.JSONEnvelope {
+		result = envelopeResult(responses, took)
+	} else if len(result.(map[string]interface{})) == 0 {
+		fmt.Fprintln(w, "{}")
+		return nil
+	}
+
+	output, err := marshalIndentJSON(result)
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	fmt.Fprintln(w, string(output))
+
+	return nil
+}
+
+// workerStatus is one entry of the --include-offline JSON list
+type workerStatus struct {
+	Worker string `json:"worker"`
+	Online bool   `json:"online"`
+}
+
+// formatWorkerStatus renders every requested destination, in the order given,
+// with whether it replied; a worker that timed out counts as offline. Other
+// workers that replied (e.g. matched by a glob) follow, sorted by name.
+func formatWorkerStatus(w io.Writer, responses map[string]broker.PingResponse, destinations []string) error {
+	statuses := make([]workerStatus, 0, len(destinations)+len(responses))
+	requested := make(map[string]bool, len(destinations))
+	for _, dest := range destinations {
+		if requested[dest] {
+			continue
+		}
+		requested[dest] = true
+		response, replied := responses[dest]
+		statuses = append(statuses, workerStatus{Worker: dest, Online: replied && response.Status != broker.StatusTimeout})
+	}
+
+	var others []string
+	for name := range responses {
+		if !requested[name] {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	for _, name := range others {
+		statuses = append(statuses, workerStatus{Worker: name, Online: responses[name].Status != broker.StatusTimeout})
+	}
+
+	output, err := marshalIndentJSON(statuses)
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	fmt.Fprintln(w, string(output))
+
+	return nil
+}
+
+// pingSummary is the --summary-only JSON object. Requested is the number of
+// destinations, or "broadcast" without any.
+type pingSummary struct {
+	Online    int         `json:"online"`
+	Requested interface{} `json:"requested"`
+	Missing   int         `json:"missing"`
+}
+
+// formatSummary renders only the counts: healthy workers, requested
+// destinations and destinations without a healthy reply, as a JSON object
+// or a single text line.
+func formatSummary(w io.Writer, responses map[string]broker.PingResponse, destinations []string, asJSON bool) error {
+	summary := pingSummary{Requested: "broadcast"}
+	for _, response := range responses {
+		if response.Healthy() {
+			summary.Online++
+		}
+	}
+
+	requested := make(map[string]bool, len(destinations))
+	for _, dest := range destinations {
+		if requested[dest] {
+			continue
+		}
+		requested[dest] = true
+		if response, replied := responses[dest]; !replied || !response.Healthy() {
+			summary.Missing++
+		}
+	}
+	if len(requested) > 0 {
+		summary.Requested = len(requested)
+	}
+
+	if asJSON {
+		output, err := marshalIndentJSON(summary)
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		fmt.Fprintln(w, string(output))
+		return nil
+	}
+
+	if len(requested) == 0 {
+		fmt.Fprintf(w, "%d nodes online (broadcast).\n", summary.Online)
+		return nil
+	}
+	fmt.Fprintf(w, "%d nodes online, %d requested, %d missing.\n", summary.Online, len(requested), summary.Missing)
+	return nil
+}
+
+// envelopeResult builds the --json-envelope document: the worker map under
+// "workers" and the online/requested counts, duration, broker type and the
+// ping ticket(s) under "summary"
+func envelopeResult(responses map[string]broker.PingResponse, took time.Duration) map[string]interface{} {
+	online := 0
+	for _, response := range responses {
+		if response.Healthy() {
+			online++
+		}
+	}
+
+	summary := map[string]interface{}{
+		"online":      online,
+		"requested":   len(cfg.Destination),
+		"duration_ms": took.Milliseconds(),
+		"broker":      cfg.BrokerType,
+	}
+	// A ping split over several messages (destination batches, AMQP
+	// shards) has a ticket per message
+	switch tickets := pingTickets.list(); len(tickets) {
+	case 0:
+	case 1:
+		summary["ticket"] = tickets[0]
+	default:
+		summary["tickets"] = tickets
+	}
+
+	return map[string]interface{}{
+		"workers": resultMap(responses),
+		"summary": summary,
+	}
+}
+
+// formatYAML renders the same worker map as formatJSON, with keys sorted;
+// no replies is an empty mapping
+func formatYAML(w io.Writer, responses map[string]broker.PingResponse, took time.Duration) error {
+	output, err := yaml.Marshal(resultMap(responses))
+	if err != nil {
+		return fmt.Errorf("failed to marshal YAML: %w", err)
+	}
+	_, err = w.Write(output)
+	return err
+}
+
+// resultMap builds the Celery-compatible worker map, adding any extra reply
+// fields under "meta", with --full the whole parsed reply under "raw" and
+// the number of duplicate replies under "dup_count". Only worker names are
+// top-level keys; the duration goes in the --json-envelope summary.
+func resultMap(responses map[string]broker.PingResponse) map[string]interface{} {
+	result := make(map[string]interface{})
+	for _, response := range responses {
+		entry := map[string]interface{}{
+			"ok": response.Status,
+		}
+		if response.Status == broker.StatusError || response.Status == broker.StatusTimeout {
+			entry = map[string]interface{}{
+				"error": response.Error,
+			}
+		}
+		if response.Slow {
+			entry["status"] = statusSlow
+		}
+		if len(response.Meta) > 0 {
+			entry["meta"] = response.Meta
+		}
+		if cfg.Full {
+			if response.Raw != nil {
+				entry["raw"] = response.Raw
+			}
+			entry["dup_count"] = response.Duplicates
+			if response.Queue != "" {
+				entry["queue"] = response.Queue
+			}
+			if response.ClockSkew != 0 {
+				entry["clock_skew_ms"] = response.ClockSkew.Milliseconds()
+			}
+		}
+		result[response.WorkerName] = entry
+	}
+	return result
+}
+
+// formatText renders one line per worker followed by the online count and
+// the measured duration; no replies is reported like celery does. Output to
+// a terminal is colorized.
+func formatText(w io.Writer, responses map[string]broker.PingResponse, took time.Duration) error {
+	return writeText(w, responses, took, useColor(w))
+}
+
+// writeText is formatText with color explicitly enabled or disabled
+func writeText(w io.Writer, responses map[string]broker.PingResponse, took time.Duration, color bool) error {
+	if len(responses) == 0 {
+		fmt.Fprintln(w, colorize(color, ansiRed, "Error: No nodes replied within time constraint."))
+		printTook(w, took)
+		return nil
+	}
+
+	online := 0
+	for _, response := range responses {
+		if response.Status == broker.StatusError {
+			fmt.Fprintf(w, "%s: %s\n", response.WorkerName, colorize(color, ansiRed, "ERROR "+response.Error))
+			continue
+		}
+		if response.Status == broker.StatusTimeout {
+			fmt.Fprintf(w, "%s: %s\n", response.WorkerName, colorize(color, ansiYellow, "TIMEOUT "+response.Error))
+			continue
+		}
+		if response.Slow {
+			fmt.Fprintf(w, "%s: %s\n", response.WorkerName, colorize(color, ansiYellow, fmt.Sprintf("SLOW %s (%v)", response.Status, response.Latency.Round(time.Millisecond))))
+		} else {
+			fmt.Fprintf(w, "%s: %s\n", response.WorkerName, colorize(color, ansiGreen, "OK "+response.Status))
+		}
+		online++
+	}
+
+	summaryColor := ansiGreen
+	if online < len(responses) {
+		summaryColor = ansiYellow
+	}
+	fmt.Fprintln(w, colorize(color, summaryColor, fmt.Sprintf("%d nodes online.", online)))
+	printTook(w, took)
+
+	return nil
+}
+
+// statusSlow is the status shown for replies marked slow by --slow-threshold
+const statusSlow = "slow"
+
+// displayStatus is the status formats show for response: "slow" for a
+// slow reply, else the reply's own status
+func displayStatus(response broker.PingResponse) string {
+	if response.Slow {
+		return statusSlow
+	}
+	return response.Status
+}
+
+// printTook writes the trailing "took" line of text output, if measured
+func printTook(w io.Writer, took time.Duration) {
+	if took > 0 {
+		fmt.Fprintf(w, "took %v\n", took.Round(time.Millisecond))
+	}
+}
+
+// formatCSV renders a header row followed by one row per worker, sorted by
+// name; no replies is the header alone. The duration is left out to keep
+// every row a worker.
+func formatCSV(w io.Writer, responses map[string]broker.PingResponse, took time.Duration) error {
+	names := make([]string, 0, len(responses))
+	for name := range responses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"worker_name", "status", "timestamp"}); err != nil {
+		return fmt.Errorf("failed to write CSV: %w", err)
+	}
+	for _, name := range names {
+		response := responses[name]
+		record := []string{response.WorkerName, displayStatus(response), formatTimestamp(response.Timestamp)}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("failed to write CSV: %w", err)
+		}
+	}
+	writer.Flush()
+
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return nil
+}
+
+// formatTimestamp renders a unix timestamp according to the configured
+// timestamp format; an unset timestamp renders empty
+func formatTimestamp(timestamp int64) string {
+	if timestamp == 0 {
+		return ""
+	}
+	if cfg.TimestampFormat == "unix" {
+		return strconv.FormatInt(timestamp, 10)
+	}
+	return time.Unix(timestamp, 0).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,813 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"fast-celery-ping/internal/broker"
+	"fast-celery-ping/internal/config"
+)
+
+func TestOutputResults(t *testing.T) {
+	tests := []struct {
+		name         string
+		responses    map[string]broker.PingResponse
+		outputFormat string
+		expectedOut  string
+	}{
+		{
+			name: "single response JSON",
+			responses: map[string]broker.PingResponse{
+				"worker1@host": {
+					WorkerName: "worker1@host",
+					Status:     "pong",
+					Timestamp:  1234567890,
+				},
+			},
+			outputFormat: "json",
+			expectedOut:  `"worker1@host": {`,
+		},
+		{
+			name: "single response text",
+			responses: map[string]broker.PingResponse{
+				"worker1@host": {
+					WorkerName: "worker1@host",
+					Status:     "pong",
+					Timestamp:  1234567890,
+				},
+			},
+			outputFormat: "text",
+			expectedOut:  "worker1@host: OK pong",
+		},
+		{
+			name: "multiple responses JSON",
+			responses: map[string]broker.PingResponse{
+				"worker1@host": {
+					WorkerName: "worker1@host",
+					Status:     "pong",
+					Timestamp:  1234567890,
+				},
+				"worker2@host": {
+					WorkerName: "worker2@host",
+					Status:     "pong",
+					Timestamp:  1234567891,
+				},
+			},
+			outputFormat: "json",
+			expectedOut:  `"ok": "pong"`,
+		},
+		{
+			name: "multiple responses text",
+			responses: map[string]broker.PingResponse{
+				"worker1@host": {
+					WorkerName: "worker1@host",
+					Status:     "pong",
+					Timestamp:  1234567890,
+				},
+				"worker2@host": {
+					WorkerName: "worker2@host",
+					Status:     "pong",
+					Timestamp:  1234567891,
+				},
+			},
+			outputFormat: "text",
+			expectedOut:  "2 nodes online.",
+		},
+		{
+			name: "error reply JSON",
+			responses: map[string]broker.PingResponse{
+				"worker1@host": {
+					WorkerName: "worker1@host",
+					Status:     broker.StatusError,
+					Error:      "pool exhausted",
+				},
+			},
+			outputFormat: "json",
+			expectedOut:  `"error": "pool exhausted"`,
+		},
+		{
+			name: "error reply text",
+			responses: map[string]broker.PingResponse{
+				"worker1@host": {
+					WorkerName: "worker1@host",
+					Status:     "pong",
+				},
+				"worker2@host": {
+					WorkerName: "worker2@host",
+					Status:     broker.StatusError,
+					Error:      "pool exhausted",
+				},
+			},
+			outputFormat: "text",
+			expectedOut:  "worker2@host: ERROR pool exhausted",
+		},
+		{
+			name: "error reply not counted online",
+			responses: map[string]broker.PingResponse{
+				"worker1@host": {
+					WorkerName: "worker1@host",
+					Status:     "pong",
+				},
+				"worker2@host": {
+					WorkerName: "worker2@host",
+					Status:     broker.StatusError,
+					Error:      "pool exhausted",
+				},
+			},
+			outputFormat: "text",
+			expectedOut:  "1 nodes online.",
+		},
+		{
+			name: "reply metadata JSON",
+			responses: map[string]broker.PingResponse{
+				"worker1@host": {
+					WorkerName: "worker1@host",
+					Status:     "pong",
+					Meta:       map[string]interface{}{"sw_ver": "5.4.0"},
+				},
+			},
+			outputFormat: "json",
+			expectedOut:  "\"meta\": {\n      \"sw_ver\": \"5.4.0\"\n    }",
+		},
+		{
+			name: "reply metadata text stays terse",
+			responses: map[string]broker.PingResponse{
+				"worker1@host": {
+					WorkerName: "worker1@host",
+					Status:     "pong",
+					Meta:       map[string]interface{}{"sw_ver": "5.4.0"},
+				},
+			},
+			outputFormat: "text",
+			expectedOut:  "worker1@host: OK pong\n1 nodes online.\n",
+		},
+		{
+			name: "timeout text",
+			responses: map[string]broker.PingResponse{
+				"worker1@host": {
+					WorkerName: "worker1@host",
+					Status:     broker.StatusTimeout,
+					Error:      "no reply within 500ms",
+				},
+			},
+			outputFormat: "text",
+			expectedOut:  "worker1@host: TIMEOUT no reply within 500ms",
+		},
+		{
+			name: "slow reply text",
+			responses: map[string]broker.PingResponse{
+				"worker1@host": {
+					WorkerName: "worker1@host",
+					Status:     "pong",
+					Latency:    1200300 * time.Microsecond,
+					Slow:       true,
+				},
+			},
+			outputFormat: "text",
+			expectedOut:  "worker1@host: SLOW pong (1.2s)\n1 nodes online.\n",
+		},
+		{
+			name: "slow reply JSON",
+			responses: map[string]broker.PingResponse{
+				"worker1@host": {
+					WorkerName: "worker1@host",
+					Status:     "pong",
+					Slow:       true,
+				},
+			},
+			outputFormat: "json",
+			expectedOut:  "\"ok\": \"pong\",\n    \"status\": \"slow\"",
+		},
+		{
+			name: "slow reply CSV",
+			responses: map[string]broker.PingResponse{
+				"worker1@host": {
+					WorkerName: "worker1@host",
+					Status:     "pong",
+					Slow:       true,
+				},
+			},
+			outputFormat: "csv",
+			expectedOut:  "worker1@host,slow,",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Set the output format
+			cfg = &config.Config{
+				OutputFormat: tt.outputFormat,
+			}
+
+			var buf bytes.Buffer
+			err := outputResults(&buf, tt.responses, 0)
+			output := buf.String()
+
+			if err != nil {
+				t.Errorf("Expected no error, got: %v", err)
+			}
+
+			if !strings.Contains(output, tt.expectedOut) {
+				t.Errorf("Expected output to contain '%s', got: '%s'", tt.expectedOut, output)
+			}
+		})
+	}
+}
+
+func TestOutputResults_InvalidFormat(t *testing.T) {
+	responses := map[string]broker.PingResponse{
+		"worker@host": {
+			WorkerName: "worker@host",
+			Status:     "pong",
+			Timestamp:  1234567890,
+		},
+	}
+
+	cfg = &config.Config{
+		OutputFormat: "invalid",
+	}
+
+	var buf bytes.Buffer
+	err := outputResults(&buf, responses, 0)
+	if err == nil {
+		t.Error("Expected error for invalid output format")
+	}
+
+	if !strings.Contains(err.Error(), "unsupported output format") {
+		t.Errorf("Expected error about unsupported format, got: %v", err)
+	}
+}
+
+func TestOpenOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.json")
+	if err := os.WriteFile(path, []byte("stale content that must be truncated"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg = &config.Config{
+		OutputFormat: "json",
+		OutputFile:   path,
+	}
+
+	out, closeOutput, err := openOutput()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	err = outputResults(out, map[string]broker.PingResponse{
+		"worker1@host": {WorkerName: "worker1@host", Status: "pong"},
+	}, 0)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := closeOutput(); err != nil {
+		t.Fatalf("Expected no error closing output, got: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "{\n  \"worker1@host\": {\n    \"ok\": \"pong\"\n  }\n}\n"
+	if string(data) != expected {
+		t.Errorf("Expected file content %q, got %q", expected, string(data))
+	}
+}
+
+func TestOpenOutput_InvalidPath(t *testing.T) {
+	cfg = &config.Config{
+		OutputFile: filepath.Join(t.TempDir(), "missing", "results.json"),
+	}
+
+	if _, _, err := openOutput(); err == nil {
+		t.Error("Expected error opening output file in missing directory")
+	}
+}
+
+func TestOpenPingOutput_CheckMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.json")
+	if err := os.WriteFile(path, []byte("previous results"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg = &config.Config{OutputFile: path, CheckOnly: true}
+	_, closeOutput, err := openPingOutput()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := closeOutput(); err != nil {
+		t.Fatalf("Expected no error closing output, got: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "previous results" {
+		t.Errorf("Expected check mode to leave the output file alone, got %q", string(data))
+	}
+}
+
+func TestOutputResults_NonASCIIWorkerNames(t *testing.T) {
+	names := []string{"célery@hôst-ü", "工作者@主机", "a&b<c>@host", "emoji🚀@host"}
+	responses := make(map[string]broker.PingResponse, len(names))
+	for _, name := range names {
+		responses[name] = broker.PingResponse{WorkerName: name, Status: "pong"}
+	}
+
+	tests := []struct {
+		name   string
+		config *config.Config
+		// line is how each worker name shows up in the output
+		line func(name string) string
+	}{
+		{
+			name:   "json",
+			config: &config.Config{OutputFormat: "json"},
+			line:   func(name string) string { return `"` + name + `": {` },
+		},
+		{
+			name:   "json envelope",
+			config: &config.Config{OutputFormat: "json", JSONEnvelope: true},
+			line:   func(name string) string { return `"` + name + `": {` },
+		},
+		{
+			name:   "json fields",
+			config: &config.Config{OutputFormat: "json", Fields: []string{"worker", "status"}},
+			line:   func(name string) string { return `"worker": "` + name + `"` },
+		},
+		{
+			name:   "include offline",
+			config: &config.Config{OutputFormat: "json", IncludeOffline: true, Destination: []string{names[0]}},
+			line:   func(name string) string { return `"worker": "` + name + `"` },
+		},
+		{
+			name:   "text",
+			config: &config.Config{OutputFormat: "text"},
+			line:   func(name string) string { return name + ": OK pong\n" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg = tt.config
+			var buf bytes.Buffer
+			if err := outputResults(&buf, responses, 0); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			output := buf.String()
+			for _, name := range names {
+				if !strings.Contains(output, tt.line(name)) {
+					t.Errorf("Expected %q unescaped in the output, got:\n%s", name, output)
+				}
+			}
+			if tt.config.OutputFormat == "json" && !json.Valid(buf.Bytes()) {
+				t.Errorf("Expected valid JSON, got:\n%s", output)
+			}
+		})
+	}
+}
+
+func TestOutputResults_EmptyDoesNotExit(t *testing.T) {
+	cfg = &config.Config{
+		OutputFormat: "json",
+	}
+
+	var buf bytes.Buffer
+	if err := outputResults(&buf, map[string]broker.PingResponse{}, 0); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if buf.String() != "{}\n" {
+		t.Errorf("Expected empty JSON object, got %q", buf.String())
+	}
+}
+
+func TestFormatters_CoverSupportedFormats(t *testing.T) {
+	for _, format := range config.SupportedOutputFormats {
+		if _, ok := formatters[format]; !ok {
+			t.Errorf("Output format %s validates but has no formatter", format)
+		}
+	}
+	for format := range formatters {
+		if !config.IsSupportedOutputFormat(format) {
+			t.Errorf("Formatter %s is not listed in config.SupportedOutputFormats", format)
+		}
+	}
+}
+
+func TestFormatters_EmptyResult(t *testing.T) {
+	expected := map[string]string{
+		"json": "{}\n",
+		"text": "Error: No nodes replied within time constraint.\n",
+		"csv":  "worker_name,status,timestamp\n",
+		"yaml": "{}\n",
+	}
+
+	for name, formatter := range formatters {
+		t.Run(name, func(t *testing.T) {
+			want, ok := expected[name]
+			if !ok {
+				t.Fatalf("No empty-result expectation for format %s", name)
+			}
+
+			var buf bytes.Buffer
+			if err := formatter(&buf, map[string]broker.PingResponse{}, 0); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if buf.String() != want {
+				t.Errorf("Expected empty output %q, got %q", want, buf.String())
+			}
+		})
+	}
+}
+
+func TestFormatYAML(t *testing.T) {
+	cfg = &config.Config{OutputFormat: "yaml"}
+	responses := map[string]broker.PingResponse{
+		"worker2@host": {WorkerName: "worker2@host", Status: broker.StatusError, Error: "boom"},
+		"worker1@host": {WorkerName: "worker1@host", Status: "pong"},
+	}
+
+	var buf bytes.Buffer
+	if err := outputResults(&buf, responses, 0); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	expected := "worker1@host:\n    ok: pong\nworker2@host:\n    error: boom\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestFormatCSV(t *testing.T) {
+	responses := map[string]broker.PingResponse{
+		"worker2@host": {WorkerName: "worker2@host", Status: broker.StatusError, Error: "pool exhausted", Timestamp: 1700000001},
+		"worker1@host": {WorkerName: "worker1@host", Status: "pong", Timestamp: 1700000000},
+	}
+
+	tests := []struct {
+		name            string
+		timestampFormat string
+		expected        string
+	}{
+		{
+			name:            "rfc3339 timestamps",
+			timestampFormat: "rfc3339",
+			expected: "worker_name,status,timestamp\n" +
+				"worker1@host,pong,2023-11-14T22:13:20Z\n" +
+				"worker2@host,error,2023-11-14T22:13:21Z\n",
+		},
+		{
+			name:            "unix timestamps",
+			timestampFormat: "unix",
+			expected: "worker_name,status,timestamp\n" +
+				"worker1@host,pong,1700000000\n" +
+				"worker2@host,error,1700000001\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg = &config.Config{
+				OutputFormat:    "csv",
+				TimestampFormat: tt.timestampFormat,
+			}
+
+			var buf bytes.Buffer
+			if err := outputResults(&buf, responses, 0); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if buf.String() != tt.expected {
+				t.Errorf("Expected CSV %q, got %q", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestFormatJSON_Full(t *testing.T) {
+	response := broker.PingResponse{
+		WorkerName: "worker1@host",
+		Status:     "pong",
+		Raw: map[string]interface{}{
+			"worker1@host": map[string]interface{}{"ok": "pong"},
+		},
+	}
+	duplicated := response
+	duplicated.Duplicates = 3
+
+	tests := []struct {
+		name      string
+		full      bool
+		responses map[string]broker.PingResponse
+		expected  string
+	}{
+		{
+			name:      "without full",
+			full:      false,
+			responses: map[string]broker.PingResponse{"worker1@host": duplicated},
+			expected:  "{\n  \"worker1@host\": {\n    \"ok\": \"pong\"\n  }\n}\n",
+		},
+		{
+			name:      "with full",
+			full:      true,
+			responses: map[string]broker.PingResponse{"worker1@host": response},
+			expected: "{\n  \"worker1@host\": {\n    \"dup_count\": 0,\n    \"ok\": \"pong\",\n    \"raw\": {\n" +
+				"      \"worker1@host\": {\n        \"ok\": \"pong\"\n      }\n    }\n  }\n}\n",
+		},
+		{
+			name:      "with full and duplicate replies",
+			full:      true,
+			responses: map[string]broker.PingResponse{"worker1@host": duplicated},
+			expected: "{\n  \"worker1@host\": {\n    \"dup_count\": 3,\n    \"ok\": \"pong\",\n    \"raw\": {\n" +
+				"      \"worker1@host\": {\n        \"ok\": \"pong\"\n      }\n    }\n  }\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg = &config.Config{OutputFormat: "json", Full: tt.full}
+
+			var buf bytes.Buffer
+			if err := outputResults(&buf, tt.responses, 0); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if buf.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestOutputResults_Duration(t *testing.T) {
+	responses := map[string]broker.PingResponse{
+		"worker1@host": {WorkerName: "worker1@host", Status: "pong"},
+	}
+
+	tests := []struct {
+		name         string
+		outputFormat string
+		responses    map[string]broker.PingResponse
+		expected     string
+	}{
+		{
+			name:         "text",
+			outputFormat: "text",
+			responses:    responses,
+			expected:     "worker1@host: OK pong\n1 nodes online.\ntook 412ms\n",
+		},
+		{
+			name:         "text without replies",
+			outputFormat: "text",
+			responses:    map[string]broker.PingResponse{},
+			expected:     "Error: No nodes replied within time constraint.\ntook 412ms\n",
+		},
+		{
+			name:         "json",
+			outputFormat: "json",
+			responses:    responses,
+			expected:     "{\n  \"worker1@host\": {\n    \"ok\": \"pong\"\n  }\n}\n",
+		},
+		{
+			name:         "json without replies",
+			outputFormat: "json",
+			responses:    map[string]broker.PingResponse{},
+			expected:     "{}\n",
+		},
+		{
+			name:         "yaml leaves duration out",
+			outputFormat: "yaml",
+			responses:    responses,
+			expected:     "worker1@host:\n    ok: pong\n",
+		},
+		{
+			name:         "csv leaves duration out",
+			outputFormat: "csv",
+			responses:    responses,
+			expected:     "worker_name,status,timestamp\nworker1@host,pong,\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg = &config.Config{OutputFormat: tt.outputFormat}
+
+			var buf bytes.Buffer
+			if err := outputResults(&buf, tt.responses, 412*time.Millisecond+300*time.Microsecond); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestFormatWorkerStatus(t *testing.T) {
+	tests := []struct {
+		name         string
+		destinations []string
+		responses    map[string]broker.PingResponse
+		expected     string
+	}{
+		{
+			name:         "online and offline destinations",
+			destinations: []string{"w2@h", "w1@h"},
+			responses:    map[string]broker.PingResponse{"w1@h": {WorkerName: "w1@h", Status: "pong"}},
+			expected: "[\n  {\n    \"worker\": \"w2@h\",\n    \"online\": false\n  },\n" +
+				"  {\n    \"worker\": \"w1@h\",\n    \"online\": true\n  }\n]\n",
+		},
+		{
+			name:         "timed out destination is offline",
+			destinations: []string{"w1@h"},
+			responses:    map[string]broker.PingResponse{"w1@h": {WorkerName: "w1@h", Status: broker.StatusTimeout}},
+			expected:     "[\n  {\n    \"worker\": \"w1@h\",\n    \"online\": false\n  }\n]\n",
+		},
+		{
+			name:         "unrequested responder is appended",
+			destinations: []string{"w1@h"},
+			responses:    map[string]broker.PingResponse{"w3@h": {WorkerName: "w3@h", Status: "pong"}},
+			expected: "[\n  {\n    \"worker\": \"w1@h\",\n    \"online\": false\n  },\n" +
+				"  {\n    \"worker\": \"w3@h\",\n    \"online\": true\n  }\n]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg = &config.Config{OutputFormat: "json", IncludeOffline: true, Destination: tt.destinations}
+
+			var buf bytes.Buffer
+			if err := outputResults(&buf, tt.responses, 0); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestFormatSummary(t *testing.T) {
+	responses := map[string]broker.PingResponse{
+		"w1@h": {WorkerName: "w1@h", Status: "pong"},
+		"w2@h": {WorkerName: "w2@h", Status: broker.StatusTimeout},
+		"w3@h": {WorkerName: "w3@h", Status: "pong"},
+	}
+
+	tests := []struct {
+		name         string
+		format       string
+		destinations []string
+		expected     string
+	}{
+		{
+			name:         "json with destinations",
+			format:       "json",
+			destinations: []string{"w1@h", "w2@h", "w4@h", "w1@h"},
+			expected:     "{\n  \"online\": 2,\n  \"requested\": 3,\n  \"missing\": 2\n}\n",
+		},
+		{
+			name:     "json broadcast",
+			format:   "json",
+			expected: "{\n  \"online\": 2,\n  \"requested\": \"broadcast\",\n  \"missing\": 0\n}\n",
+		},
+		{
+			name:         "text with destinations",
+			format:       "text",
+			destinations: []string{"w1@h", "w2@h", "w4@h"},
+			expected:     "2 nodes online, 3 requested, 2 missing.\n",
+		},
+		{
+			name:     "text broadcast",
+			format:   "text",
+			expected: "2 nodes online (broadcast).\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg = &config.Config{OutputFormat: tt.format, SummaryOnly: true, Destination: tt.destinations}
+
+			var buf bytes.Buffer
+			if err := outputResults(&buf, responses, time.Second); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestOutputConsole(t *testing.T) {
+	responses := map[string]broker.PingResponse{
+		"w1@h": {WorkerName: "w1@h", Status: "pong"},
+		"w2@h": {WorkerName: "w2@h", Status: broker.StatusTimeout},
+	}
+	cfg = &config.Config{OutputFormat: "json", OutputFile: "results.json", ConsoleFormat: "summary", Destination: []string{"w1@h", "w2@h"}}
+
+	var file, console bytes.Buffer
+	if err := outputResults(&file, responses, 0); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := outputConsole(&console, responses, 0); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	var workers map[string]interface{}
+	if err := json.Unmarshal(file.Bytes(), &workers); err != nil {
+		t.Fatalf("Expected the file to get json, got %q: %v", file.String(), err)
+	}
+	if expected := "1 nodes online, 2 requested, 1 missing.\n"; console.String() != expected {
+		t.Errorf("Expected console %q, got %q", expected, console.String())
+	}
+
+	cfg.ConsoleFormat = "text"
+	console.Reset()
+	if err := outputConsole(&console, responses, 0); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !strings.Contains(console.String(), "w1@h: OK pong") {
+		t.Errorf("Expected text output on the console, got %q", console.String())
+	}
+}
+
+func TestFormatJSON_Envelope(t *testing.T) {
+	cfg = &config.Config{OutputFormat: "json", JSONEnvelope: true, BrokerType: "redis", Destination: []string{"w1@h", "w2@h"}}
+	responses := map[string]broker.PingResponse{
+		"w1@h": {WorkerName: "w1@h", Status: "pong"},
+		"w2@h": {WorkerName: "w2@h", Status: broker.StatusError, Error: "shutting down"},
+	}
+
+	var buf bytes.Buffer
+	if err := outputResults(&buf, responses, 1503*time.Millisecond); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Expected valid JSON, got %q: %v", buf.String(), err)
+	}
+	expected := map[string]interface{}{
+		"workers": map[string]interface{}{
+			"w1@h": map[string]interface{}{"ok": "pong"},
+			"w2@h": map[string]interface{}{"error": "shutting down"},
+		},
+		"summary": map[string]interface{}{
+			"online":      1.0,
+			"requested":   2.0,
+			"duration_ms": 1503.0,
+			"broker":      "redis",
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestFormatJSON_EnvelopeTickets(t *testing.T) {
+	cfg = &config.Config{OutputFormat: "json", JSONEnvelope: true, BrokerType: "redis"}
+	defer pingTickets.reset()
+	responses := map[string]broker.PingResponse{"w1@h": {WorkerName: "w1@h", Status: "pong"}}
+
+	summary := func() map[string]interface{} {
+		var buf bytes.Buffer
+		if err := outputResults(&buf, responses, 0); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		var got struct {
+			Summary map[string]interface{} `json:"summary"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("Expected valid JSON, got %q: %v", buf.String(), err)
+		}
+		return got.Summary
+	}
+
+	pingTickets.reset()
+	pingTickets.record("stats", "not-a-ping")
+	if got := summary(); got["ticket"] != nil || got["tickets"] != nil {
+		t.Errorf("Expected no ticket before a ping was sent, got %v", got)
+	}
+
+	pingTickets.record("ping", "3f2b8c1e-0001")
+	if got := summary(); got["ticket"] != "3f2b8c1e-0001" || got["tickets"] != nil {
+		t.Errorf("Expected the ping ticket, got %v", got)
+	}
+
+	pingTickets.record("ping", "3f2b8c1e-0002")
+	expected := []interface{}{"3f2b8c1e-0001", "3f2b8c1e-0002"}
+	if got := summary(); got["ticket"] != nil || !reflect.DeepEqual(got["tickets"], expected) {
+		t.Errorf("Expected both tickets of a split ping, got %v", got)
+	}
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// pingCmd represents the ping command; the root command runs the same ping
+// when no subcommand is given
+var pingCmd = &cobra.Command{
+	Use:   "ping",
+	Short: "Ping the workers (default command)",
+	Long: `Ping Celery workers and report which replied, like 'celery inspect ping'.
+This is what running fast-celery-ping without a subcommand does.`,
+	RunE: runPing,
+}
+
+func init() {
+	addPingFlags(pingCmd.Flags())
+	rootCmd.AddCommand(pingCmd)
+}
+
+// addPingFlags registers the flags only pinging understands. They are local
+// flags, so other subcommands (serve, inspect, diag) do not inherit them.
+func addPingFlags(flags *pflag.FlagSet) {
+	flags.DurationVar(&wait, "wait", 0, "Keep pinging until enough workers are online, giving up after this long (readiness gate)")
+	flags.DurationVar(&waitInterval, "wait-interval", 0, "Delay between pings in --wait mode (default 1s)")
+	flags.IntVar(&waitMinWorkers, "wait-min-workers", 0, "Healthy workers required to stop waiting in --wait mode (default 1)")
+	flags.IntVar(&intervalJitter, "interval-jitter", 0, "Randomize each --wait delay by up to this percentage either way (0-100)")
+}
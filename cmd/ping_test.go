@@ -0,0 +1,34 @@
+package cmd
+
+import "testing"
+
+func TestPingFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantWait bool
+	}{
+		{name: "root command pings", args: nil, wantWait: true},
+		{name: "ping subcommand", args: []string{"ping"}, wantWait: true},
+		{name: "serve does not inherit ping flags", args: []string{"serve"}, wantWait: false},
+		{name: "inspect does not inherit ping flags", args: []string{"inspect"}, wantWait: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			command, _, err := rootCmd.Find(tt.args)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			for _, name := range []string{"wait", "wait-interval", "wait-min-workers", "interval-jitter"} {
+				if hasFlag := command.Flags().Lookup(name) != nil; hasFlag != tt.wantWait {
+					t.Errorf("Expected --%s on %q: %v, got %v", name, command.Name(), tt.wantWait, hasFlag)
+				}
+			}
+			if tt.wantWait && command.RunE == nil {
+				t.Errorf("Expected %q to run the ping", command.Name())
+			}
+		})
+	}
+}
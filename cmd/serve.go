@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"fast-celery-ping/internal/broker"
+	"fast-celery-ping/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+// shutdownTimeout bounds how long in-flight requests may take on shutdown
+const shutdownTimeout = 5 * time.Second
+
+var (
+	listenAddr    string
+	metricsWindow time.Duration
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve ping results over HTTP",
+	Long: `Run as a long-lived HTTP server that pings workers on demand.
+
+Endpoints:
+  /ping     Celery-compatible JSON worker map (503 if no worker replied)
+  /healthz  Broker connectivity check
+  /metrics  Prometheus counters for the pings served so far
+
+A single broker connection is reused across requests.`,
+	RunE: runServe,
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&listenAddr, "listen", ":8080", "Address to listen on")
+	serveCmd.Flags().DurationVar(&metricsWindow, "metrics-window", defaultMetricsWindow, "Window for the rolling success ratio on /metrics")
+	rootCmd.AddCommand(serveCmd)
+}
+
+// pingServer answers HTTP requests using one shared broker connection
+type pingServer struct {
+	// mu serializes access to the broker connection
+	mu           sync.Mutex
+	broker       broker.Broker
+	timeout      time.Duration
+	destinations []string
+	metrics      *pingMetrics
+}
+
+// handlePing pings the workers and writes the JSON worker map
+func (s *pingServer) handlePing(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout+pingGracePeriod)
+	defer cancel()
+
+	// Narrow before recording, so excluded workers neither get a gauge
+	// nor count a ping that answers 503 as successful
+	responses, err := s.broker.Ping(ctx, s.timeout, s.destinations)
+	responses = narrowResponses(responses)
+	s.metrics.record(responses, err)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("ping failed: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	var body bytes.Buffer
+	if err := formatJSON(&body, responses, 0); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(responses) == 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(body.Bytes())
+}
+
+// handleHealthz reports whether the broker connection is usable
+func (s *pingServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.broker.Health(r.Context()); err != nil {
+		http.Error(w, fmt.Sprintf("broker unhealthy: %v", err), http.StatusServiceUnavailable)
+		return
+	}
+
+	fmt.Fprintln(w, "ok")
+}
+
+// handleMetrics writes the ping counters in Prometheus text format
+func (s *pingServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	s.metrics.writeTo(w)
+}
+
+// routes returns the HTTP handler for the server
+func (s *pingServer) routes() http.Handler {
+	if s.metrics == nil {
+		s.metrics = newPingMetrics(defaultMetricsWindow)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ping", s.handlePing)
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	return mux
+}
+
+// runServe connects once and serves HTTP until SIGINT/SIGTERM
+func runServe(cmd *cobra.Command, args []string) error {
+	if metricsWindow <= 0 {
+		return fmt.Errorf("metrics window must be positive")
+	}
+
+	brokerInstance, err := broker.NewBroker(cfg.BrokerType, newBrokerConfig())
+	if err != nil {
+		return fmt.Errorf("failed to create broker: %w", err)
+	}
+
+	connectCtx, connectCancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
+	defer connectCancel()
+
+	if err := brokerInstance.Connect(connectCtx); err != nil {
+		return fmt.Errorf("failed to connect to broker: %w", err)
+	}
+	defer brokerInstance.Close()
+
+	server := &http.Server{
+		Addr: listenAddr,
+		Handler: (&pingServer{
+			broker:       brokerInstance,
+			timeout:      cfg.Timeout,
+			destinations: pingDestinations(),
+			metrics:      newPingMetrics(metricsWindow),
+		}).routes(),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if cfg.Verbose {
+			fmt.Fprintf(os.Stderr, "Listening on %s (%s broker: %s)\n", listenAddr, cfg.BrokerType, config.RedactURL(cfg.BrokerURL))
+		}
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return fmt.Errorf("server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	if cfg.Verbose {
+		fmt.Fprintln(os.Stderr, "Shutting down...")
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	return server.Shutdown(shutdownCtx)
+}
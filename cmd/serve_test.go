@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"fast-celery-ping/internal/broker"
+	"fast-celery-ping/internal/config"
+)
+
+// stubBroker is a broker.Broker returning canned results. When rounds is
+// set, each Ping returns the next entry (repeating the last one).
+type stubBroker struct {
+	responses map[string]broker.PingResponse
+	rounds    []map[string]broker.PingResponse
+	pingErr   error
+	healthErr error
+	pings     int
+}
+
+func (s *stubBroker) Ping(ctx context.Context, timeout time.Duration, destinations []string) (map[string]broker.PingResponse, error) {
+	s.pings++
+	if len(s.rounds) > 0 {
+		return s.rounds[min(s.pings, len(s.rounds))-1], s.pingErr
+	}
+	return s.responses, s.pingErr
+}
+
+func (s *stubBroker) Inspect(ctx context.Context, command string, timeout time.Duration, destinations []string) (map[string]json.RawMessage, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *stubBroker) Connect(ctx context.Context) error { return nil }
+
+func (s *stubBroker) Close() error { return nil }
+
+func (s *stubBroker) Health(ctx context.Context) error { return s.healthErr }
+
+func (s *stubBroker) ServerInfo(ctx context.Context) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
+func (s *stubBroker) Diagnostics(ctx context.Context) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
+func TestPingServer_Ping(t *testing.T) {
+	tests := []struct {
+		name       string
+		broker     *stubBroker
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name: "workers replied",
+			broker: &stubBroker{responses: map[string]broker.PingResponse{
+				"worker1@host": {WorkerName: "worker1@host", Status: "pong"},
+			}},
+			wantStatus: http.StatusOK,
+			wantBody:   `"worker1@host"`,
+		},
+		{
+			name:       "no workers replied",
+			broker:     &stubBroker{responses: map[string]broker.PingResponse{}},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "{}",
+		},
+		{
+			name:       "broker error",
+			broker:     &stubBroker{pingErr: errors.New("connection reset")},
+			wantStatus: http.StatusBadGateway,
+			wantBody:   "connection reset",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg = &config.Config{}
+			server := &pingServer{broker: tt.broker, timeout: 100 * time.Millisecond}
+
+			recorder := httptest.NewRecorder()
+			server.routes().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/ping", nil))
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, recorder.Code)
+			}
+			if !strings.Contains(recorder.Body.String(), tt.wantBody) {
+				t.Errorf("Expected body to contain %q, got %q", tt.wantBody, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestPingServer_ReusesBroker(t *testing.T) {
+	stub := &stubBroker{responses: map[string]broker.PingResponse{}}
+	handler := (&pingServer{broker: stub, timeout: 100 * time.Millisecond}).routes()
+
+	for i := 0; i < 3; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ping", nil))
+	}
+
+	if stub.pings != 3 {
+		t.Errorf("Expected 3 pings on the shared broker, got %d", stub.pings)
+	}
+}
+
+func TestPingServer_Healthz(t *testing.T) {
+	healthy := (&pingServer{broker: &stubBroker{}}).routes()
+	recorder := httptest.NewRecorder()
+	healthy.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", recorder.Code)
+	}
+
+	unhealthy := (&pingServer{broker: &stubBroker{healthErr: errors.New("closed")}}).routes()
+	recorder = httptest.NewRecorder()
+	unhealthy.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", recorder.Code)
+	}
+}
+
+func TestPingServer_Metrics(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	now := start
+	metrics := newPingMetrics(time.Minute)
+	metrics.now = func() time.Time { return now }
+
+	stub := &stubBroker{rounds: []map[string]broker.PingResponse{
+		{},
+		{"worker1@host": {WorkerName: "worker1@host", Status: "pong"}},
+		{`odd"name`: {WorkerName: `odd"name`, Status: "pong"}},
+	}}
+	handler := (&pingServer{broker: stub, timeout: 100 * time.Millisecond, metrics: metrics}).routes()
+
+	for i := 0; i < 3; i++ {
+		now = start.Add(time.Duration(i) * 40 * time.Second)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ping", nil))
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := recorder.Body.String()
+
+	// The first (failed) ping at +0s is outside the one minute window at +80s
+	for _, want := range []string{
+		"# TYPE celery_ping_total counter\ncelery_ping_total 3\n",
+		"celery_ping_success_total 2\n",
+		"celery_ping_last_success_timestamp_seconds 1700000080\n",
+		"celery_ping_success_ratio 1\n",
+		`celery_worker_last_seen_timestamp{worker="odd\"name"} 1700000080` + "\n",
+		`celery_worker_last_seen_timestamp{worker="worker1@host"} 1700000040` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestPingServer_Metrics_Excluded(t *testing.T) {
+	cfg = &config.Config{Exclude: []string{"debug-*"}}
+	defer func() { cfg = &config.Config{} }()
+
+	now := time.Unix(1700000000, 0)
+	metrics := newPingMetrics(time.Minute)
+	metrics.now = func() time.Time { return now }
+
+	stub := &stubBroker{rounds: []map[string]broker.PingResponse{
+		{"debug-1@host": {WorkerName: "debug-1@host", Status: "pong"}},
+		{
+			"debug-1@host": {WorkerName: "debug-1@host", Status: "pong"},
+			"worker1@host": {WorkerName: "worker1@host", Status: "pong"},
+		},
+	}}
+	handler := (&pingServer{broker: stub, timeout: 100 * time.Millisecond, metrics: metrics}).routes()
+
+	// Only an excluded worker answers the first ping
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", recorder.Code)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ping", nil))
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := recorder.Body.String()
+
+	for _, want := range []string{
+		"celery_ping_total 2\n",
+		"celery_ping_success_total 1\n",
+		"celery_ping_success_ratio 0.5\n",
+		`celery_worker_last_seen_timestamp{worker="worker1@host"} 1700000000` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "debug-1@host") {
+		t.Errorf("Expected no gauge for the excluded worker, got:\n%s", body)
+	}
+}
+
+func TestPingMetrics_SuccessRatio(t *testing.T) {
+	tests := []struct {
+		name     string
+		outcomes []error
+		expected float64
+	}{
+		{name: "no pings", expected: 0},
+		{name: "all failed", outcomes: []error{errors.New("down"), errors.New("down")}, expected: 0},
+		{name: "half succeeded", outcomes: []error{nil, errors.New("down")}, expected: 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := newPingMetrics(time.Minute)
+			for _, err := range tt.outcomes {
+				responses := map[string]broker.PingResponse{"worker1@host": {Status: "pong"}}
+				if err != nil {
+					responses = nil
+				}
+				metrics.record(responses, err)
+			}
+			if ratio := metrics.successRatio(); ratio != tt.expected {
+				t.Errorf("Expected ratio %v, got %v", tt.expected, ratio)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"fast-celery-ping/internal/broker"
+	"fast-celery-ping/internal/config"
+)
+
+// templateData is what --format-template executes against
+type templateData struct {
+	// Workers are sorted by name
+	Workers []templateWorker
+	Summary templateSummary
+}
+
+// templateWorker is one worker's reply; Latency is rounded to the millisecond
+// and Slow is set by --slow-threshold
+type templateWorker struct {
+	Name    string
+	Status  string
+	Online  bool
+	Slow    bool
+	Latency time.Duration
+	Error   string
+	Meta    map[string]interface{}
+}
+
+// templateSummary mirrors the --json-envelope summary; Requested is the
+// number of --destination workers (0 for a broadcast)
+type templateSummary struct {
+	Online    int
+	Total     int
+	Requested int
+	Duration  time.Duration
+	Broker    string
+}
+
+// formatTemplate renders the results with the user's text/template
+func formatTemplate(w io.Writer, responses map[string]broker.PingResponse, text string, took time.Duration) error {
+	tmpl, err := config.ParseFormatTemplate(text)
+	if err != nil {
+		return err
+	}
+	if err := tmpl.Execute(w, newTemplateData(responses, took)); err != nil {
+		return fmt.Errorf("failed to execute format template: %w", err)
+	}
+	return nil
+}
+
+// newTemplateData collects the responses into a templateData
+func newTemplateData(responses map[string]broker.PingResponse, took time.Duration) templateData {
+	names := make([]string, 0, len(responses))
+	for name := range responses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	data := templateData{
+		Workers: make([]templateWorker, len(names)),
+		Summary: templateSummary{
+			Total:     len(responses),
+			Requested: len(cfg.Destination),
+			Duration:  took.Round(time.Millisecond),
+			Broker:    cfg.BrokerType,
+		},
+	}
+	for i, name := range names {
+		response := responses[name]
+		if response.Healthy() {
+			data.Summary.Online++
+		}
+		data.Workers[i] = templateWorker{
+			Name:    response.WorkerName,
+			Status:  response.Status,
+			Online:  response.Healthy(),
+			Slow:    response.Slow,
+			Latency: response.Latency.Round(time.Millisecond),
+			Error:   response.Error,
+			Meta:    response.Meta,
+		}
+	}
+	return data
+}
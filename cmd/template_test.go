@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"fast-celery-ping/internal/broker"
+	"fast-celery-ping/internal/config"
+)
+
+func TestFormatTemplate(t *testing.T) {
+	responses := map[string]broker.PingResponse{
+		"w2@h": {WorkerName: "w2@h", Status: broker.StatusError, Error: "shutting down"},
+		"w1@h": {
+			WorkerName: "w1@h",
+			Status:     "pong",
+			Latency:    12345 * time.Microsecond,
+			Meta:       map[string]interface{}{"sw_ver": "5.3.0"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{
+			name:     "workers sorted with escapes expanded",
+			template: `{{range .Workers}}{{.Name}}\t{{.Latency}}\n{{end}}`,
+			expected: "w1@h\t12ms\nw2@h\t0s\n",
+		},
+		{
+			name:     "summary",
+			template: `{{.Summary.Online}}/{{.Summary.Total}} online on {{.Summary.Broker}} in {{.Summary.Duration}}`,
+			expected: "1/2 online on redis in 1.5s",
+		},
+		{
+			name:     "errors and meta",
+			template: `{{range .Workers}}{{if .Online}}{{.Name}} {{.Meta.sw_ver}}{{else}}{{.Name}}: {{.Error}}{{end}};{{end}}`,
+			expected: "w1@h 5.3.0;w2@h: shutting down;",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg = &config.Config{OutputFormat: "text", BrokerType: "redis", FormatTemplate: tt.template}
+
+			var buf bytes.Buffer
+			if err := outputResults(&buf, responses, 1500*time.Millisecond); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestFormatTemplate_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		errMsg   string
+	}{
+		{
+			name:     "parse error",
+			template: "{{.Workers",
+			errMsg:   "invalid format template:",
+		},
+		{
+			name:     "unknown field",
+			template: "{{.Nodes}}",
+			errMsg:   "failed to execute format template:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg = &config.Config{OutputFormat: "text", FormatTemplate: tt.template}
+
+			var buf bytes.Buffer
+			err := outputResults(&buf, nil, 0)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.errMsg) {
+				t.Errorf("Expected error starting with %q, got: %v", tt.errMsg, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import "sync"
+
+// ticketLog collects the tickets of the control messages a ping publishes,
+// for the --json-envelope summary; safe for concurrent use
+type ticketLog struct {
+	mu      sync.Mutex
+	tickets []string
+}
+
+// pingTickets holds the tickets of the last ping round
+var pingTickets ticketLog
+
+// record is a broker.Config.OnSend hook keeping the ping tickets
+func (l *ticketLog) record(method, ticket string) {
+	if method != "ping" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tickets = append(l.tickets, ticket)
+}
+
+// reset forgets the tickets of an earlier round
+func (l *ticketLog) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tickets = nil
+}
+
+// list returns the recorded tickets in publish order
+func (l *ticketLog) list() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.tickets...)
+}
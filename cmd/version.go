@@ -1,8 +1,15 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 	"runtime"
+	"sort"
+
+	"fast-celery-ping/internal/broker"
 
 	"github.com/spf13/cobra"
 )
@@ -15,24 +22,105 @@ var (
 	Platform  = fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH)
 )
 
+var showBrokerInfo bool
+
 // versionCmd represents the version command
 var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Print version information",
-	Long:  `Print detailed version information including build platform and commit.`,
+	Long: `Print detailed version information including build platform and commit.
+With --broker, also connect to the configured broker and report its server version.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Printf("fast-celery-ping version %s\n", Version)
 		fmt.Printf("Build time: %s\n", BuildTime)
 		fmt.Printf("Go version: %s\n", GoVersion)
 		fmt.Printf("Platform: %s\n", Platform)
+
+		if showBrokerInfo {
+			info, err := queryBrokerInfo()
+			formatBrokerInfo(os.Stdout, cfg.BrokerType, info, err)
+		}
 	},
 }
 
 func init() {
+	versionCmd.Flags().BoolVar(&showBrokerInfo, "broker", false, "Also connect to the broker and print its server info")
 	rootCmd.AddCommand(versionCmd)
 }
 
-// GetVersionInfo returns formatted version information for inclusion in help text
-func GetVersionInfo() string {
-	return fmt.Sprintf("fast-celery-ping %s (%s)", Version, Platform)
+// VersionInfo describes this build; it is what --version --format json prints
+type VersionInfo struct {
+	Version   string `json:"version"`
+	BuildTime string `json:"build_time"`
+	Go        string `json:"go"`
+	Platform  string `json:"platform"`
+}
+
+// String formats the version for inclusion in help text
+func (v VersionInfo) String() string {
+	return fmt.Sprintf("fast-celery-ping %s (%s)", v.Version, v.Platform)
+}
+
+// GetVersionInfo returns the version information set at build time
+func GetVersionInfo() VersionInfo {
+	return VersionInfo{
+		Version:   Version,
+		BuildTime: BuildTime,
+		Go:        GoVersion,
+		Platform:  Platform,
+	}
+}
+
+// versionOutput is what the root command's --version flag prints: a JSON
+// object with --format json, else one line. It runs before the
+// configuration is loaded, so only the flag selects JSON.
+func versionOutput() string {
+	info := GetVersionInfo()
+	if format != "json" {
+		return info.String() + "\n"
+	}
+
+	output, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return info.String() + "\n"
+	}
+	return string(output) + "\n"
+}
+
+// queryBrokerInfo connects to the configured broker and fetches its server info
+func queryBrokerInfo() (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
+	defer cancel()
+
+	brokerInstance, err := broker.NewBroker(cfg.BrokerType, newBrokerConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := brokerInstance.Connect(ctx); err != nil {
+		return nil, err
+	}
+	defer brokerInstance.Close()
+
+	return brokerInstance.ServerInfo(ctx)
+}
+
+// formatBrokerInfo writes broker server info, or why it is unavailable
+func formatBrokerInfo(w io.Writer, brokerType string, info map[string]string, err error) {
+	if err != nil {
+		fmt.Fprintf(w, "Broker (%s): unavailable (%v)\n", brokerType, err)
+		return
+	}
+
+	fmt.Fprintf(w, "Broker (%s):\n", brokerType)
+
+	keys := make([]string, 0, len(info))
+	for key := range info {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fmt.Fprintf(w, "  %s: %s\n", key, info[key])
+	}
 }
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestFormatBrokerInfo(t *testing.T) {
+	tests := []struct {
+		name       string
+		brokerType string
+		info       map[string]string
+		err        error
+		expected   string
+	}{
+		{
+			name:       "redis info sorted by key",
+			brokerType: "redis",
+			info: map[string]string{
+				"redis_version": "7.2.4",
+				"redis_mode":    "standalone",
+			},
+			expected: "Broker (redis):\n  redis_mode: standalone\n  redis_version: 7.2.4\n",
+		},
+		{
+			name:       "amqp info",
+			brokerType: "amqp",
+			info: map[string]string{
+				"product": "RabbitMQ",
+				"version": "3.13.0",
+			},
+			expected: "Broker (amqp):\n  product: RabbitMQ\n  version: 3.13.0\n",
+		},
+		{
+			name:       "unreachable broker",
+			brokerType: "redis",
+			err:        errors.New("connection refused"),
+			expected:   "Broker (redis): unavailable (connection refused)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			formatBrokerInfo(&buf, tt.brokerType, tt.info, tt.err)
+
+			if buf.String() != tt.expected {
+				t.Errorf("Expected output %q, got %q", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestRootCommand_VersionFlag(t *testing.T) {
+	defer func() {
+		format = ""
+		rootCmd.Flags().Set("version", "false")
+		rootCmd.SetArgs(nil)
+		rootCmd.SetOut(nil)
+	}()
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "text",
+			args:     []string{"--version"},
+			expected: "fast-celery-ping " + Version + " (" + Platform + ")\n",
+		},
+		{
+			name: "json",
+			args: []string{"-V", "--format", "json"},
+			expected: "{\n" +
+				"  \"version\": \"" + Version + "\",\n" +
+				"  \"build_time\": \"" + BuildTime + "\",\n" +
+				"  \"go\": \"" + GoVersion + "\",\n" +
+				"  \"platform\": \"" + Platform + "\"\n" +
+				"}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format = ""
+			var buf bytes.Buffer
+			rootCmd.SetOut(&buf)
+			rootCmd.SetArgs(tt.args)
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, buf.String())
+			}
+		})
+	}
+}
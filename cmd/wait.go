@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"fast-celery-ping/internal/broker"
+)
+
+// waitForWorkers pings repeatedly, every interval (randomized by ±jitter
+// percent), until at least minWorkers healthy replies arrive in a single
+// round. It gives up when ctx is done (the --wait deadline or a signal) and
+// returns the last round's replies together with an error describing how far
+// it got.
+func waitForWorkers(ctx context.Context, b broker.Broker, timeout time.Duration, destinations []string, minWorkers int, interval time.Duration, jitter int) (map[string]broker.PingResponse, error) {
+	start := time.Now()
+	responses := map[string]broker.PingResponse{}
+	var lastErr error
+
+	for attempt := 1; ; attempt++ {
+		roundStart := time.Now()
+		pingCtx, cancel := context.WithTimeout(ctx, timeout+pingGracePeriod)
+		pingTickets.reset()
+		round, err := b.Ping(pingCtx, timeout, destinations)
+		cancel()
+		roundTook := time.Since(roundStart).Round(time.Millisecond)
+
+		// A failed round (e.g. broker still starting) is retried like an
+		// empty one; only the deadline ends the wait
+		lastErr = err
+		sleep := sleepInterval(ctx, interval, jitter, rand.Float64())
+		if err == nil {
+			responses = narrowResponses(round)
+			online := healthyCount(responses)
+			if online >= minWorkers {
+				return responses, nil
+			}
+			if cfg.Verbose {
+				fmt.Fprintf(os.Stderr, "Attempt %d (%v): %d of %d workers online, retrying in %v\n", attempt, roundTook, online, minWorkers, sleep.Round(time.Millisecond))
+			}
+		} else if cfg.Verbose {
+			fmt.Fprintf(os.Stderr, "Attempt %d failed after %v: %v, retrying in %v\n", attempt, roundTook, err, sleep.Round(time.Millisecond))
+		}
+
+		select {
+		case <-ctx.Done():
+			waited := time.Since(start).Round(time.Millisecond)
+			if lastErr != nil {
+				return responses, fmt.Errorf("gave up waiting for workers after %v: %w", waited, lastErr)
+			}
+			return responses, fmt.Errorf("gave up waiting for workers after %v: %d of %d online", waited, healthyCount(responses), minWorkers)
+		case <-time.After(sleep):
+		}
+	}
+}
+
+// sleepInterval is interval shifted by up to ±jitter percent, so many
+// pollers started together spread out; r in [0, 1) picks the shift. The
+// result is never negative and never runs past ctx's deadline.
+func sleepInterval(ctx context.Context, interval time.Duration, jitter int, r float64) time.Duration {
+	sleep := interval
+	if jitter > 0 {
+		shift := float64(interval) * float64(jitter) / 100 * (2*r - 1)
+		sleep = max(interval+time.Duration(shift), 0)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		sleep = max(min(sleep, time.Until(deadline)), 0)
+	}
+	return sleep
+}
+
+// healthyCount returns how many responses are healthy pongs
+func healthyCount(responses map[string]broker.PingResponse) int {
+	count := 0
+	for _, response := range responses {
+		if response.Healthy() {
+			count++
+		}
+	}
+	return count
+}
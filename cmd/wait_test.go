@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"fast-celery-ping/internal/broker"
+	"fast-celery-ping/internal/config"
+)
+
+func TestWaitForWorkers(t *testing.T) {
+	pong := func(names ...string) map[string]broker.PingResponse {
+		responses := make(map[string]broker.PingResponse)
+		for _, name := range names {
+			responses[name] = broker.PingResponse{WorkerName: name, Status: "pong"}
+		}
+		return responses
+	}
+
+	tests := []struct {
+		name       string
+		broker     *stubBroker
+		minWorkers int
+		wantPings  int
+		wantErr    string
+	}{
+		{
+			name:       "already online",
+			broker:     &stubBroker{responses: pong("worker1@host")},
+			minWorkers: 1,
+			wantPings:  1,
+		},
+		{
+			name: "workers come up over time",
+			broker: &stubBroker{rounds: []map[string]broker.PingResponse{
+				{},
+				pong("worker1@host"),
+				pong("worker1@host", "worker2@host"),
+			}},
+			minWorkers: 2,
+			wantPings:  3,
+		},
+		{
+			name: "error replies do not count",
+			broker: &stubBroker{responses: map[string]broker.PingResponse{
+				"worker1@host": {WorkerName: "worker1@host", Status: broker.StatusError, Error: "boom"},
+			}},
+			minWorkers: 1,
+			wantErr:    "0 of 1 online",
+		},
+		{
+			name:       "broker keeps failing",
+			broker:     &stubBroker{pingErr: errors.New("connection refused")},
+			minWorkers: 1,
+			wantErr:    "connection refused",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg = &config.Config{}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			_, err := waitForWorkers(ctx, tt.broker, 10*time.Millisecond, nil, tt.minWorkers, 10*time.Millisecond, 50)
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if tt.broker.pings != tt.wantPings {
+				t.Errorf("Expected %d pings, got %d", tt.wantPings, tt.broker.pings)
+			}
+		})
+	}
+}
+
+func TestWaitForWorkers_Cancelled(t *testing.T) {
+	cfg = &config.Config{}
+	stub := &stubBroker{responses: map[string]broker.PingResponse{}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	if _, err := waitForWorkers(ctx, stub, 10*time.Millisecond, nil, 1, time.Hour, 0); err == nil {
+		t.Fatal("Expected error when context is cancelled")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected cancellation to stop waiting immediately, took %v", elapsed)
+	}
+}
+
+func TestSleepInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		jitter   int
+		r        float64
+		want     time.Duration
+	}{
+		{name: "no jitter", interval: time.Second, jitter: 0, r: 0, want: time.Second},
+		{name: "shortest", interval: time.Second, jitter: 20, r: 0, want: 800 * time.Millisecond},
+		{name: "middle", interval: time.Second, jitter: 20, r: 0.5, want: time.Second},
+		{name: "longest", interval: time.Second, jitter: 20, r: 0.75, want: 1100 * time.Millisecond},
+		{name: "full jitter never negative", interval: time.Second, jitter: 100, r: 0, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sleepInterval(context.Background(), tt.interval, tt.jitter, tt.r); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSleepInterval_CappedByDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if got := sleepInterval(ctx, time.Second, 50, 0.99); got > 100*time.Millisecond {
+		t.Errorf("Expected the sleep to stop at the deadline, got %v", got)
+	}
+}
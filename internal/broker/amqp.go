@@ -2,58 +2,190 @@ package broker
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net"
+	"os"
 	"time"
 
 	"fast-celery-ping/internal/protocol"
 
 	amqp "github.com/rabbitmq/amqp091-go"
+	"golang.org/x/net/proxy"
 )
 
+// Connection defaults applied when the config leaves them unset
+const (
+	defaultHeartbeat = 10 * time.Second
+	defaultLocale    = "en_US"
+	// defaultDialTimeout bounds dialling and the AMQP handshake when the
+	// connect context has no deadline, like amqp091's own default
+	defaultDialTimeout = 30 * time.Second
+)
+
+// healthTimeout bounds the Health probe, so a hung but connected server
+// fails fast
+const healthTimeout = 2 * time.Second
+
+// directReplyTo is RabbitMQ's direct reply-to pseudo-queue, which needs no
+// declaration or binding
+const directReplyTo = "amq.rabbitmq.reply-to"
+
 // AMQPBroker implements the Broker interface for AMQP/RabbitMQ
 type AMQPBroker struct {
 	connection *amqp.Connection
 	channel    *amqp.Channel
 	config     Config
 	handler    *protocol.Handler
+	// connClosed and chanClosed receive the server's reason when it closes
+	// the connection or the main channel
+	connClosed <-chan *amqp.Error
+	chanClosed <-chan *amqp.Error
+}
+
+func init() {
+	register("amqp", func(config Config) Broker { return NewAMQPBroker(config) })
 }
 
 // NewAMQPBroker creates a new AMQP broker instance
 func NewAMQPBroker(config Config) *AMQPBroker {
 	return &AMQPBroker{
 		config:  config,
-		handler: protocol.NewHandler(),
+		handler: protocol.NewHandlerWithID(config.NodeID),
+	}
+}
+
+// configureHandler applies the protocol options to the handler
+func (a *AMQPBroker) configureHandler() error {
+	if err := configureHandler(a.handler, a.config); err != nil {
+		return err
+	}
+	// Direct replies are published through the default exchange
+	if a.config.DirectReply {
+		a.handler.SetExchanges(a.config.pidboxExchange(), "")
 	}
+	return nil
 }
 
 // Connect establishes connection to AMQP broker
 func (a *AMQPBroker) Connect(ctx context.Context) error {
+	if err := a.configureHandler(); err != nil {
+		return err
+	}
+
+	dialConfig := a.dialConfig()
+
+	// Only used for amqps:// URLs; nil keeps the library defaults
 	var err error
+	dialConfig.TLSClientConfig, err = a.config.tlsConfig(nil)
+	if err != nil {
+		return err
+	}
+
+	// amqp091's default dialer knows nothing of ctx, so dial through our
+	// own to keep the connect deadline
+	dialer, err := proxyDialer(a.config.Proxy, 0)
+	if err != nil {
+		return err
+	}
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	dialConfig.Dial = amqpDial(ctx, dialer)
 
 	// Create connection with authentication if provided
-	a.connection, err = amqp.Dial(a.config.URL)
+	a.connection, err = amqp.DialConfig(a.config.URL, dialConfig)
 	if err != nil {
-		return fmt.Errorf("failed to connect to AMQP broker: %w", err)
+		return withKind(ErrConnectFailed, amqpConnectError(err, brokerAddr(a.config.URL)))
 	}
 
 	// Create channel
 	a.channel, err = a.connection.Channel()
 	if err != nil {
 		a.connection.Close()
-		return fmt.Errorf("failed to create AMQP channel: %w", err)
+		return withKind(ErrConnectFailed, fmt.Errorf("failed to create AMQP channel: %w", err))
 	}
 
+	// The library sends the close reason before closing the consumers, so
+	// one buffered slot is enough and never blocks it
+	a.connClosed = a.connection.NotifyClose(make(chan *amqp.Error, 1))
+	a.chanClosed = a.channel.NotifyClose(make(chan *amqp.Error, 1))
+
 	// Declare required exchanges
 	err = a.declareExchanges()
 	if err != nil {
 		a.Close()
-		return fmt.Errorf("failed to declare exchanges: %w", err)
+		return withKind(ErrConnectFailed, fmt.Errorf("failed to declare exchanges: %w", err))
 	}
 
 	// Test connection
 	return a.Health(ctx)
 }
 
+// amqpDial adapts dialer, a proxy or a plain net.Dialer, for amqp091, which
+// does the TLS handshake itself. ctx's deadline, or defaultDialTimeout
+// without one, covers dialling and the AMQP handshake; the library clears
+// it once the connection is open.
+func amqpDial(ctx context.Context, dialer proxy.ContextDialer) func(network, addr string) (net.Conn, error) {
+	return func(network, addr string) (net.Conn, error) {
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			deadline = time.Now().Add(defaultDialTimeout)
+		}
+		dialCtx, cancel := context.WithDeadline(ctx, deadline)
+		defer cancel()
+
+		conn, err := dialer.DialContext(dialCtx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		if err := conn.SetDeadline(deadline); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+// dialConfig builds the connection settings: the vhost override (empty keeps
+// the URL's vhost), the client-provided connection name shown in the
+// RabbitMQ management UI, and the heartbeat that keeps long --wait runs
+// from being dropped by the server
+func (a *AMQPBroker) dialConfig() amqp.Config {
+	properties := amqp.NewConnectionProperties()
+	properties.SetClientConnectionName(a.connectionName())
+
+	heartbeat := a.config.Heartbeat
+	if heartbeat <= 0 {
+		heartbeat = defaultHeartbeat
+	}
+	locale := a.config.Locale
+	if locale == "" {
+		locale = defaultLocale
+	}
+
+	return amqp.Config{
+		Vhost:      a.config.VHost,
+		Properties: properties,
+		Heartbeat:  heartbeat,
+		Locale:     locale,
+	}
+}
+
+// connectionName returns the configured connection name, defaulting to
+// fast-celery-ping@<hostname>
+func (a *AMQPBroker) connectionName() string {
+	if a.config.ConnectionName != "" {
+		return a.config.ConnectionName
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return "fast-celery-ping@" + hostname
+}
+
 // Close closes the AMQP connection and channel
 func (a *AMQPBroker) Close() error {
 	if a.channel != nil {
@@ -68,89 +200,217 @@ func (a *AMQPBroker) Close() error {
 // Health checks AMQP connectivity
 func (a *AMQPBroker) Health(ctx context.Context) error {
 	if a.connection == nil {
-		return fmt.Errorf("AMQP connection not initialized")
+		return withKind(ErrNotConnected, fmt.Errorf("AMQP connection not initialized"))
 	}
 
 	if a.connection.IsClosed() {
-		return fmt.Errorf("AMQP connection is closed")
+		return withKind(ErrNotConnected, fmt.Errorf("AMQP connection is closed"))
 	}
 
 	if a.channel == nil {
-		return fmt.Errorf("AMQP channel not initialized")
+		return withKind(ErrNotConnected, fmt.Errorf("AMQP channel not initialized"))
 	}
 
+	// Opening and closing a throwaway channel is a cheap server round trip,
+	// so a hung server still holding the TCP connection fails the check
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+	defer cancel()
+
+	err := probeWithin(ctx, func() error {
+		channel, err := a.connection.Channel()
+		if err != nil {
+			return err
+		}
+		return channel.Close()
+	})
+	if err != nil {
+		return withKind(ErrNotConnected, fmt.Errorf("AMQP health probe failed: %w", err))
+	}
 	return nil
 }
 
+// probeWithin runs probe, which cannot be cancelled (amqp091 calls take no
+// context), and gives up waiting for it once ctx is done. An abandoned
+// probe finishes on its own when the connection times out.
+func probeWithin(ctx context.Context, probe func() error) error {
+	result := make(chan error, 1)
+	go func() {
+		result <- probe()
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ServerInfo reports the server properties announced during the AMQP handshake
+func (a *AMQPBroker) ServerInfo(ctx context.Context) (map[string]string, error) {
+	if err := a.Health(ctx); err != nil {
+		return nil, err
+	}
+
+	return amqpServerInfo(a.connection.Major, a.connection.Minor, a.connection.Properties), nil
+}
+
+// Diagnostics reports every server property announced during the AMQP
+// handshake, with nested tables such as capabilities flattened
+func (a *AMQPBroker) Diagnostics(ctx context.Context) (map[string]string, error) {
+	if err := a.Health(ctx); err != nil {
+		return nil, err
+	}
+
+	return amqpDiagnostics(a.connection.Major, a.connection.Minor, a.connection.Properties), nil
+}
+
+// amqpDiagnostics flattens AMQP server properties into dotted keys, e.g.
+// "capabilities.publisher_confirms"
+func amqpDiagnostics(major, minor int, properties amqp.Table) map[string]string {
+	info := map[string]string{
+		"protocol": fmt.Sprintf("AMQP %d-%d", major, minor),
+	}
+	flattenTable(info, "", properties)
+	return info
+}
+
+// flattenTable copies table into info, prefixing nested keys with prefix
+func flattenTable(info map[string]string, prefix string, table amqp.Table) {
+	for key, value := range table {
+		if nested, ok := value.(amqp.Table); ok {
+			flattenTable(info, prefix+key+".", nested)
+			continue
+		}
+		info[prefix+key] = fmt.Sprint(value)
+	}
+}
+
+// amqpServerInfo extracts the interesting fields from AMQP server properties
+func amqpServerInfo(major, minor int, properties amqp.Table) map[string]string {
+	info := map[string]string{
+		"protocol": fmt.Sprintf("AMQP %d-%d", major, minor),
+	}
+
+	for _, field := range []string{"product", "version", "platform", "cluster_name"} {
+		if value, ok := properties[field].(string); ok && value != "" {
+			info[field] = value
+		}
+	}
+	return info
+}
+
 // declareExchanges declares the required AMQP exchanges for Celery
 func (a *AMQPBroker) declareExchanges() error {
-	// Declare the pidbox exchange (fanout exchange for broadcasting control messages)
-	// Use passive declaration first to check if exchange exists with different type
-	err := a.channel.ExchangeDeclarePassive(
-		"celery.pidbox", // name
-		"fanout",        // type
-		true,            // durable
-		false,           // auto-delete
-		false,           // internal
-		false,           // no-wait
-		nil,             // args
-	)
-	if err != nil {
-		// If passive declaration fails, try to declare the exchange
-		err = a.channel.ExchangeDeclare(
-			"celery.pidbox", // name
-			"fanout",        // type
-			true,            // durable
-			false,           // auto-delete
-			false,           // internal
-			false,           // no-wait
-			nil,             // args
-		)
-		if err != nil {
-			return fmt.Errorf("failed to declare celery.pidbox exchange: %w", err)
-		}
+	// The pidbox exchange fans control messages out to every worker; the
+	// reply exchange routes answers back to our reply queue
+	if err := a.declareExchange(a.config.pidboxExchange(), "fanout"); err != nil {
+		return err
 	}
+	return a.declareExchange(a.config.replyExchange(), "direct")
+}
 
-	// Declare the reply exchange (direct exchange for reply messages)
-	err = a.channel.ExchangeDeclarePassive(
-		"reply.celery.pidbox", // name
-		"direct",              // type
-		true,                  // durable
-		false,                 // auto-delete
-		false,                 // internal
-		false,                 // no-wait
-		nil,                   // args
+// declareExchange declares a durable exchange. A passive declaration is
+// tried first so an exchange Celery already created is used as is.
+func (a *AMQPBroker) declareExchange(name, kind string) error {
+	err := a.channel.ExchangeDeclarePassive(
+		name,  // name
+		kind,  // type
+		true,  // durable
+		false, // auto-delete
+		false, // internal
+		false, // no-wait
+		nil,   // args
 	)
 	if err != nil {
 		// If passive declaration fails, try to declare the exchange
 		err = a.channel.ExchangeDeclare(
-			"reply.celery.pidbox", // name
-			"direct",              // type
-			true,                  // durable
-			false,                 // auto-delete
-			false,                 // internal
-			false,                 // no-wait
-			nil,                   // args
+			name,  // name
+			kind,  // type
+			true,  // durable
+			false, // auto-delete
+			false, // internal
+			false, // no-wait
+			nil,   // args
 		)
 		if err != nil {
-			return fmt.Errorf("failed to declare reply.celery.pidbox exchange: %w", err)
+			return fmt.Errorf("failed to declare %s exchange: %w", name, err)
 		}
 	}
-
 	return nil
 }
 
 // Ping implements the Celery ping functionality for AMQP
 func (a *AMQPBroker) Ping(ctx context.Context, timeout time.Duration, destinations []string) (map[string]PingResponse, error) {
 	if a.connection == nil || a.channel == nil {
-		return nil, fmt.Errorf("AMQP connection not initialized")
+		return nil, withKind(ErrNotConnected, fmt.Errorf("AMQP connection not initialized"))
+	}
+
+	// The response limit is shared by all shards of this ping
+	ctx, recordResponse, release := limitResponses(ctx, a.config.MaxResponses)
+	defer release()
+
+	// Targeted pings to several workers are sharded across up to MaxWorkers
+	// channels so replies are consumed in parallel
+	if len(destinations) > 1 && a.config.MaxWorkers > 1 {
+		shards := shardDestinations(destinations, a.config.MaxWorkers)
+		responses, err := fanOut(shards, a.config.MaxWorkers, func(shard []string) (map[string]PingResponse, error) {
+			channel, err := a.connection.Channel()
+			if err != nil {
+				return nil, fmt.Errorf("failed to create AMQP channel: %w", err)
+			}
+			defer channel.Close()
+			closed := channel.NotifyClose(make(chan *amqp.Error, 1))
+
+			return a.pingOnChannel(ctx, channel, closed, timeout, shard, recordResponse)
+		})
+		return responses, limitErr(ctx, err)
+	}
+
+	responses, err := a.pingOnChannel(ctx, a.channel, a.chanClosed, timeout, destinations, recordResponse)
+	return responses, limitErr(ctx, err)
+}
+
+// Inspect sends an arbitrary control command and returns each worker's raw reply
+func (a *AMQPBroker) Inspect(ctx context.Context, command string, timeout time.Duration, destinations []string) (map[string]json.RawMessage, error) {
+	if a.connection == nil || a.channel == nil {
+		return nil, withKind(ErrNotConnected, fmt.Errorf("AMQP connection not initialized"))
 	}
 
+	replies := make(map[string]json.RawMessage)
+	err := a.controlOnChannel(ctx, a.channel, a.chanClosed, command, timeout, destinations, func(body []byte, sentAt time.Time) bool {
+		return collectInspectReply(a.handler, body, replies)
+	})
+
+	return replies, err
+}
+
+// pingOnChannel publishes a ping and collects the replies using channel,
+// passing every accepted worker to recordResponse
+func (a *AMQPBroker) pingOnChannel(ctx context.Context, channel *amqp.Channel, closed <-chan *amqp.Error, timeout time.Duration, destinations []string, recordResponse func(worker string)) (map[string]PingResponse, error) {
+	responses := make(map[string]PingResponse)
+	err := a.controlOnChannel(ctx, channel, closed, "ping", timeout, destinations, func(body []byte, sentAt time.Time) bool {
+		response, err := parseReply(a.handler, body, sentAt)
+		if err != nil {
+			a.config.debugf("Dropped reply: %v\n", err)
+			return false
+		}
+		a.config.warnClockSkew(response)
+		recordResponse(response.WorkerName)
+		return addResponse(responses, response, a.config.debugf)
+	})
+
+	return responses, err
+}
+
+// declareReplyQueue declares an exclusive, auto-deleted reply queue on
+// channel and binds it to the reply exchange, returning its name
+func (a *AMQPBroker) declareReplyQueue(channel *amqp.Channel) (string, error) {
 	// Create reply queue with simple UUID format
 	replyTo := a.handler.CreateReplyQueue()
 
 	// Declare temporary reply queue
-	replyQueue, err := a.channel.QueueDeclare(
+	replyQueue, err := channel.QueueDeclare(
 		replyTo, // name
 		false,   // durable
 		true,    // delete when unused
@@ -159,105 +419,252 @@ func (a *AMQPBroker) Ping(ctx context.Context, timeout time.Duration, destinatio
 		nil,     // args
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to declare reply queue: %w", err)
+		return "", fmt.Errorf("failed to declare reply queue: %w", err)
 	}
 
 	// Bind reply queue to reply exchange
-	err = a.channel.QueueBind(
-		replyQueue.Name,       // queue name
-		replyTo,               // routing key
-		"reply.celery.pidbox", // exchange
-		false,                 // no-wait
-		nil,                   // args
+	err = channel.QueueBind(
+		replyQueue.Name,          // queue name
+		replyTo,                  // routing key
+		a.config.replyExchange(), // exchange
+		false,                    // no-wait
+		nil,                      // args
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to bind reply queue: %w", err)
+		return "", fmt.Errorf("failed to bind reply queue: %w", err)
 	}
 
-	// Create ping message in raw format (direct JSON control message)
-	pingData, err := a.handler.CreatePingMessage(replyTo, destinations, protocol.MessageFormatRaw)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create ping message: %w", err)
-	}
-
-	// Publish the ping message to the broadcast exchange
-	err = a.channel.PublishWithContext(
-		ctx,
-		"celery.pidbox", // exchange
-		"",              // routing key (empty for broadcast)
-		false,           // mandatory
-		false,           // immediate
-		amqp.Publishing{
-			ContentType:  "application/json",
-			Body:         pingData,
-			DeliveryMode: amqp.Persistent,
-		},
-	)
+	return replyQueue.Name, nil
+}
+
+// publishing wraps a control message body; with direct reply-to the
+// ReplyTo property tells RabbitMQ where to route the replies
+func (a *AMQPBroker) publishing(body []byte) amqp.Publishing {
+	publishing := amqp.Publishing{
+		ContentType:  a.handler.ContentType(),
+		Body:         body,
+		DeliveryMode: amqp.Persistent,
+	}
+	if a.config.DirectReply {
+		publishing.ReplyTo = directReplyTo
+	}
+	return publishing
+}
+
+// PreviewPing builds the ping message Ping would publish, without
+// connecting; implements Previewer
+func (a *AMQPBroker) PreviewPing(destinations []string) (ControlPreview, error) {
+	if err := a.configureHandler(); err != nil {
+		return ControlPreview{}, err
+	}
+
+	replyTo := directReplyTo
+	if !a.config.DirectReply {
+		replyTo = a.handler.CreateReplyQueue()
+	}
+	messageData, _, err := a.handler.CreateControlMessage("ping", nil, replyTo, destinations, messageExpiry(a.config.Timeout), protocol.MessageFormatRaw)
 	if err != nil {
-		return nil, fmt.Errorf("failed to publish ping message: %w", err)
+		return ControlPreview{}, fmt.Errorf("failed to create ping message: %w", err)
 	}
 
-	// Consume responses from reply queue
-	responses := make(map[string]PingResponse)
-	msgs, err := a.channel.Consume(
-		replyQueue.Name, // queue
-		"",              // consumer
-		true,            // auto-ack
-		false,           // exclusive
-		false,           // no-local
-		false,           // no-wait
-		nil,             // args
+	return ControlPreview{
+		Target:  a.config.pidboxExchange(),
+		ReplyTo: replyTo,
+		Body:    messageData,
+	}, nil
+}
+
+// Monitor binds an exclusive, server-named queue to the pidbox exchange and
+// hands over every control message fanned out to the workers; implements
+// Monitor. Replies are routed by their own reply queue's key on a direct
+// exchange, so only the control messages themselves are seen.
+func (a *AMQPBroker) Monitor(ctx context.Context, handle func(ControlEvent)) error {
+	if a.connection == nil || a.channel == nil {
+		return withKind(ErrNotConnected, fmt.Errorf("AMQP connection not initialized"))
+	}
+
+	queue, err := a.channel.QueueDeclare(
+		"",    // name (server-generated)
+		false, // durable
+		true,  // delete when unused
+		true,  // exclusive
+		false, // no-wait
+		nil,   // args
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to start consuming replies: %w", err)
+		return fmt.Errorf("failed to declare monitor queue: %w", err)
+	}
+
+	exchange := a.config.pidboxExchange()
+	if err := a.channel.QueueBind(queue.Name, "", exchange, false, nil); err != nil {
+		return fmt.Errorf("failed to bind monitor queue: %w", err)
 	}
 
-	// Wait for responses with timeout
-	deadline := time.After(timeout)
-	responseTimeout := time.NewTimer(100 * time.Millisecond) // Small timeout between responses
+	consumerTag := a.handler.CreateReplyQueue()
+	msgs, err := a.channel.Consume(queue.Name, consumerTag, true, true, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start consuming control messages: %w", err)
+	}
+	defer a.channel.Cancel(consumerTag, false)
 
 	for {
 		select {
 		case <-ctx.Done():
-			return responses, ctx.Err()
-
-		case <-deadline:
-			// Timeout reached, return collected responses
-			return responses, nil
-
+			return nil
 		case msg, ok := <-msgs:
 			if !ok {
-				// Channel closed
-				return responses, nil
+				return fmt.Errorf("AMQP channel closed while monitoring")
+			}
+			if event, ok := decodeControlEvent(a.handler, exchange, msg.Body, a.config.debugf); ok {
+				handle(event)
 			}
+		}
+	}
+}
 
-			// Reset response timeout for next message
-			responseTimeout.Reset(100 * time.Millisecond)
+// controlOnChannel publishes a control command on channel and hands every
+// reply to handle until collection stops. If the server closes channel
+// (closed) or the connection, collection stops with the close reason.
+func (a *AMQPBroker) controlOnChannel(ctx context.Context, channel *amqp.Channel, closed <-chan *amqp.Error, method string, timeout time.Duration, destinations []string, handle func(body []byte, sentAt time.Time) bool) error {
+	var (
+		replyTo string
+		msgs    <-chan amqp.Delivery
+		err     error
+	)
+	if a.config.DirectReply {
+		// The direct reply-to pseudo-queue must be consumed, with auto-ack,
+		// before publishing; RabbitMQ allows one such consumer per channel
+		replyTo = directReplyTo
+		consumerTag := a.handler.CreateReplyQueue()
+		msgs, err = channel.Consume(directReplyTo, consumerTag, true, false, false, false, nil)
+		if err != nil {
+			return fmt.Errorf("failed to consume direct reply-to: %w", err)
+		}
+		defer channel.Cancel(consumerTag, false)
+	} else if replyTo, err = a.declareReplyQueue(channel); err != nil {
+		return err
+	}
 
-			// Process the response
-			response, err := a.handler.ParseWorkerResponse(msg.Body)
-			if err != nil {
-				continue
-			}
+	// Create control messages in raw format (direct JSON control message),
+	// one per destination batch; they share the reply queue
+	var (
+		messages [][]byte
+		tickets  []string
+	)
+	for _, batch := range batchDestinations(destinations, a.config.DestinationBatchSize) {
+		messageData, ticket, err := a.handler.CreateControlMessage(method, nil, replyTo, batch, messageExpiry(timeout), protocol.MessageFormatRaw)
+		if err != nil {
+			return fmt.Errorf("failed to create %s message: %w", method, err)
+		}
+		messages = append(messages, messageData)
+		tickets = append(tickets, ticket)
+	}
 
-			if a.handler.ValidateResponse(response) {
-				workerName := a.handler.ExtractWorkerName(response)
-				if workerName != "" {
-					// Add response (map will naturally deduplicate)
-					responses[workerName] = PingResponse{
-						WorkerName: workerName,
-						Status:     "pong",
-						Timestamp:  time.Now().Unix(),
-					}
-				}
-			}
+	// Publish the control messages to the broadcast exchange
+	sentAt := time.Now()
+	for i, messageData := range messages {
+		err = publishWithRetry(ctx, a.config.RetryAttempts, isRetryableAMQPError, a.config.debugf, func() error {
+			return channel.PublishWithContext(
+				ctx,
+				a.config.pidboxExchange(), // exchange
+				"",                        // routing key (empty for broadcast)
+				false,                     // mandatory
+				false,                     // immediate
+				a.publishing(messageData),
+			)
+		})
+		if err != nil {
+			return withKind(ErrPublishFailed, fmt.Errorf("failed to publish %s message: %w", method, err))
+		}
+		a.config.sent(method, tickets[i])
+	}
+
+	// Consume responses from the classic reply queue. The consumer is
+	// cancelled once collection ends, which also lets the server delete the
+	// auto-delete queue; otherwise both would linger on the long-lived main
+	// channel (e.g. in serve mode) until it is closed.
+	if msgs == nil {
+		consumerTag := replyTo
+		msgs, err = channel.Consume(
+			replyTo,     // queue
+			consumerTag, // consumer
+			true,        // auto-ack
+			false,       // exclusive
+			false,       // no-local
+			false,       // no-wait
+			nil,         // args
+		)
+		if err != nil {
+			return fmt.Errorf("failed to start consuming replies: %w", err)
+		}
+		defer channel.Cancel(consumerTag, false)
+	}
+
+	counter := &replyCounter{debugf: a.config.debugf}
+	defer counter.summary()
 
-		case <-responseTimeout.C:
-			// Small timeout between responses to avoid waiting too long
-			// if no more responses are coming
-			if len(responses) > 0 {
-				return responses, nil
+	return collectUntilClosed(ctx, a.connClosed, closed, func(ctx context.Context) error {
+		return collectReplies(ctx, timeout, a.config.CollectionStrategy, a.config.EarlyExitAfter, len(destinations), msgs, func(msg amqp.Delivery) bool {
+			counter.add(len(msg.Body))
+
+			// Workers echo the ticket in the message headers
+			if !a.handler.MatchesAnyTicket(msg.Headers, tickets...) {
+				return false
 			}
+			return handle(msg.Body, sentAt)
+		})
+	})
+}
+
+// collectUntilClosed runs collect with a context that is cancelled as soon
+// as the connection or channel is closed, and then returns the close reason
+// instead of the (partial) collection's own result. A nil notification
+// channel is never selected.
+func collectUntilClosed(ctx context.Context, connClosed, chanClosed <-chan *amqp.Error, collect func(ctx context.Context) error) error {
+	collectCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var closeErr error
+	watching := make(chan struct{})
+	go func() {
+		defer close(watching)
+		select {
+		case reason := <-connClosed:
+			closeErr = closedError("connection", reason)
+		case reason := <-chanClosed:
+			closeErr = closedError("channel", reason)
+		case <-collectCtx.Done():
+			return
+		}
+		cancel(closeErr)
+	}()
+
+	err := collect(collectCtx)
+	cancel(nil)
+	<-watching
+
+	// A close also closes the deliveries, which can end collection before
+	// the watcher ran; the reason is already waiting in that case
+	if closeErr == nil {
+		select {
+		case reason := <-connClosed:
+			closeErr = closedError("connection", reason)
+		case reason := <-chanClosed:
+			closeErr = closedError("channel", reason)
+		default:
 		}
 	}
+	if closeErr != nil {
+		return closeErr
+	}
+	return err
+}
+
+// closedError describes a closed connection or channel; reason is nil when
+// it was closed without an error
+func closedError(what string, reason *amqp.Error) error {
+	if reason == nil {
+		return fmt.Errorf("AMQP %s closed during collection", what)
+	}
+	return fmt.Errorf("AMQP %s closed by server during collection: %w", what, reason)
 }
@@ -2,8 +2,17 @@ package broker
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"sync"
 	"time"
+
+	"fast-celery-ping/internal/config"
+	"fast-celery-ping/internal/protocol"
 )
 
 // PingResponse represents a response from a Celery worker
@@ -11,22 +20,67 @@ type PingResponse struct {
 	WorkerName string `json:"worker_name"`
 	Status     string `json:"status"`
 	Timestamp  int64  `json:"timestamp"`
+	// Latency is the time between publishing the ping and receiving the reply
+	Latency time.Duration `json:"latency"`
+	// Error is set when the worker replied with an error instead of a pong
+	Error string `json:"error,omitempty"`
+	// Meta carries any extra fields from the worker's reply (sw_ver, pool, ...)
+	Meta map[string]interface{} `json:"meta,omitempty"`
+	// Raw is the complete parsed reply, as returned by ParseWorkerResponse
+	Raw map[string]interface{} `json:"raw,omitempty"`
+	// Duplicates counts the extra replies received from this worker, e.g.
+	// when it answered on several priority queues; only the first is kept
+	Duplicates int `json:"dup_count,omitempty"`
+	// Queue is the Redis reply queue variant the reply came in on, which
+	// shows whether workers answer on the priority queues
+	Queue string `json:"queue,omitempty"`
+	// ClockSkew is how far the worker's clock is ahead of ours (negative
+	// when behind), for replies carrying a worker timestamp
+	ClockSkew time.Duration `json:"clock_skew,omitempty"`
+	// Slow marks a healthy reply that took longer than the caller's slow
+	// threshold; brokers never set it
+	Slow bool `json:"slow,omitempty"`
+}
+
+// Healthy reports whether the worker answered the ping successfully
+func (p PingResponse) Healthy() bool {
+	return p.Status != StatusError && p.Status != StatusTimeout
 }
 
+const (
+	// StatusError is the PingResponse status used for error replies
+	StatusError = "error"
+	// StatusTimeout is the PingResponse status for destinations that did not
+	// reply within their deadline
+	StatusTimeout = "timeout"
+)
+
 // Broker interface defines the contract for different message brokers
 type Broker interface {
 	// Ping sends a ping command to workers and returns their responses
 	// If destinations is empty, ping all workers. Otherwise, ping only specified workers.
 	Ping(ctx context.Context, timeout time.Duration, destinations []string) (map[string]PingResponse, error)
 
+	// Inspect sends a generic control command (e.g. "stats", "registered")
+	// and returns each worker's raw reply keyed by worker name
+	Inspect(ctx context.Context, command string, timeout time.Duration, destinations []string) (map[string]json.RawMessage, error)
+
 	// Connect establishes connection to the broker
 	Connect(ctx context.Context) error
 
 	// Close closes the connection to the broker
 	Close() error
 
-	// Health checks if the broker is reachable
+	// Health checks if the broker is reachable with a server round trip
 	Health(ctx context.Context) error
+
+	// ServerInfo returns version and settings reported by the broker server
+	ServerInfo(ctx context.Context) (map[string]string, error)
+
+	// Diagnostics returns a fuller picture of the broker server than
+	// ServerInfo (e.g. connected clients) for troubleshooting; Health stays
+	// the cheap liveness check
+	Diagnostics(ctx context.Context) (map[string]string, error)
 }
 
 // Config holds configuration for broker connections
@@ -38,6 +92,112 @@ type Config struct {
 	Timeout      time.Duration
 	OutputFormat string
 	MaxWorkers   int
+
+	// CollectionStrategy decides when to stop waiting for replies; empty
+	// means patient. EarlyExitAfter is the greedy reply gap (default 100ms).
+	CollectionStrategy CollectionStrategy
+	EarlyExitAfter     time.Duration
+
+	// ContentType is what control messages are serialized as
+	// ("application/json" or "application/x-msgpack"), and BodyEncoding how
+	// Redis envelopes carry the body ("base64" or "none"); empty values
+	// keep JSON in base64
+	ContentType  string
+	BodyEncoding string
+
+	// Serializer forces the reply body decoder ("json" or "msgpack");
+	// empty or "auto" detects it from the reply content-type
+	Serializer string
+
+	// MaxResponses stops collection as soon as this many distinct workers
+	// have replied; zero waits for all of them
+	MaxResponses int
+
+	// MaxClockSkew is the worker clock skew above which verbose output
+	// warns; zero means defaultMaxClockSkew
+	MaxClockSkew time.Duration
+
+	// Pattern and Matcher target workers by name pattern (Celery's
+	// broadcast pattern/matcher) instead of explicit destinations
+	Pattern string
+	Matcher string
+
+	// DestinationBatchSize caps the destinations named in one control
+	// message; longer lists are sent as several messages sharing one reply
+	// queue. Zero means defaultDestinationBatchSize.
+	DestinationBatchSize int
+
+	// RetryAttempts is how many times a control message is published
+	// before a transient (network) failure is returned; zero or one
+	// publishes once
+	RetryAttempts int
+
+	// NodeID is the origin named in control messages; empty means
+	// fast-celery-ping@<hostname>
+	NodeID string
+
+	// ReplyQueuePrefix gives reply queues predictable names for broker
+	// ACLs; empty means a random UUID per ping
+	ReplyQueuePrefix string
+
+	// Connection pool tuning (Redis); zero keeps the client defaults
+	PoolSize     int
+	MinIdleConns int
+	DialTimeout  time.Duration
+
+	// Socket timeouts (Redis); zero keeps the client defaults. BRPOP
+	// waits are not cut short: go-redis adds the block time to them.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// Proxy is a socks5:// or socks5h:// URL both brokers connect through
+	Proxy string
+
+	// Cluster connects to a Redis Cluster; ClusterNodes adds seed node
+	// addresses to the URL host(s) and implies Cluster, as do several
+	// comma-separated URL hosts
+	Cluster      bool
+	ClusterNodes []string
+
+	// VHost overrides the virtual host from the URL and ConnectionName is
+	// reported to the server as the client connection name (AMQP)
+	VHost          string
+	ConnectionName string
+
+	// Heartbeat is the AMQP heartbeat interval (default 10s) and Locale the
+	// connection locale (default en_US)
+	Heartbeat time.Duration
+	Locale    string
+
+	// DirectReply (AMQP) collects replies through RabbitMQ's direct
+	// reply-to pseudo-queue instead of declaring a reply queue per ping;
+	// the workers must support replying there
+	DirectReply bool
+
+	// PidboxChannel and ReplyExchange rename Celery's control exchanges
+	// for deployments using a non-default pidbox namespace; empty keeps
+	// "celery.pidbox" and "reply.celery.pidbox"
+	PidboxChannel string
+	ReplyExchange string
+
+	// TLSCA, TLSCert/TLSKey and TLSSkipVerify customize the TLS setup of
+	// rediss:// and amqps:// connections
+	TLSCA         string
+	TLSCert       string
+	TLSKey        string
+	TLSSkipVerify bool
+
+	// NoCleanup leaves the Redis reply queues and binding in place after a
+	// run so they can be inspected with redis-cli (debugging aid)
+	NoCleanup bool
+
+	// DebugLog receives verbose diagnostics; nil discards them
+	DebugLog io.Writer
+
+	// OnSend, if set, is called with the ticket of every control message
+	// once published, e.g. to correlate a ping with the worker logs. The
+	// shards of one AMQP ping call it concurrently.
+	OnSend func(method, ticket string)
 }
 
 // Validate checks if the configuration is valid
@@ -50,8 +210,8 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("timeout must be positive")
 	}
 
-	if c.OutputFormat != "json" && c.OutputFormat != "text" {
-		return fmt.Errorf("output format must be 'json' or 'text'")
+	if err := config.ValidateOutputFormat(c.OutputFormat); err != nil {
+		return err
 	}
 
 	if c.MaxWorkers <= 0 {
@@ -61,13 +221,157 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// debugf writes a verbose diagnostic to DebugLog, if set
+func (c Config) debugf(format string, args ...interface{}) {
+	if c.DebugLog != nil {
+		fmt.Fprintf(c.DebugLog, format, args...)
+	}
+}
+
+// sent reports a published control message to DebugLog and OnSend
+func (c Config) sent(method, ticket string) {
+	c.debugf("Sent %s with ticket %s\n", method, ticket)
+	if c.OnSend != nil {
+		c.OnSend(method, ticket)
+	}
+}
+
+// configureHandler applies the per-connection protocol options to handler
+func configureHandler(handler *protocol.Handler, config Config) error {
+	if err := handler.SetSerializer(config.Serializer); err != nil {
+		return err
+	}
+	if err := handler.SetMessageEncoding(config.ContentType, config.BodyEncoding); err != nil {
+		return err
+	}
+	handler.SetExchanges(config.pidboxExchange(), config.replyExchange())
+	handler.SetReplyQueuePrefix(config.ReplyQueuePrefix)
+	return handler.SetPattern(config.Pattern, config.Matcher)
+}
+
+// pidboxExchange returns the exchange control broadcasts are published to
+func (c Config) pidboxExchange() string {
+	if c.PidboxChannel != "" {
+		return c.PidboxChannel
+	}
+	return protocol.DefaultPidboxExchange
+}
+
+// replyExchange returns the exchange workers send their replies to
+func (c Config) replyExchange() string {
+	if c.ReplyExchange != "" {
+		return c.ReplyExchange
+	}
+	return protocol.DefaultReplyExchange
+}
+
+// ControlPreview is a ping message as a broker would publish it
+type ControlPreview struct {
+	// Target is the Redis channel or AMQP exchange the message goes to
+	Target string
+	// ReplyTo is the queue the workers would reply to
+	ReplyTo string
+	Body    []byte
+}
+
+// Previewer is implemented by brokers that can build their ping message
+// without connecting, for --dry-run
+type Previewer interface {
+	PreviewPing(destinations []string) (ControlPreview, error)
+}
+
+// ControlEvent is a control message seen on the pidbox by Monitor
+type ControlEvent struct {
+	// Source is the Redis channel or AMQP exchange it was seen on
+	Source   string
+	Received time.Time
+	// Message is the decoded control message, e.g. method, destination,
+	// ticket and reply_to for a ping
+	Message map[string]interface{}
+}
+
+// Monitor is implemented by brokers that can watch the control traffic on
+// the pidbox without publishing anything of their own
+type Monitor interface {
+	// Monitor hands every decoded control message to handle until ctx is
+	// done, which ends monitoring without an error
+	Monitor(ctx context.Context, handle func(ControlEvent)) error
+}
+
+// Factory creates a broker from the shared broker settings
+type Factory func(Config) Broker
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a broker type available to NewBroker and --broker-type.
+// External packages call it from init(); registering a name twice panics.
+func Register(name string, factory Factory) {
+	register(name, factory)
+	config.RegisterBrokerType(name)
+}
+
+// register adds factory without telling the config package, for the built-in
+// types it already knows (and the mock, which the CLI should not offer)
+func register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if factory == nil {
+		panic("broker: Register factory is nil for " + name)
+	}
+	if _, dup := registry[name]; dup {
+		panic("broker: Register called twice for " + name)
+	}
+	registry[name] = factory
+}
+
+// NewBroker creates a broker of a registered type
 func NewBroker(brokerType string, config Config) (Broker, error) {
-	switch brokerType {
-	case "redis":
-		return NewRedisBroker(config), nil
-	case "amqp":
-		return NewAMQPBroker(config), nil
-	default:
+	registryMu.RLock()
+	factory, ok := registry[brokerType]
+	registryMu.RUnlock()
+
+	if !ok {
 		return nil, fmt.Errorf("unsupported broker type: %s", brokerType)
 	}
+	return factory(config), nil
+}
+
+// tlsConfig applies the TLS options on top of base (which may be nil). It
+// returns base unchanged when no TLS option is set.
+func (c Config) tlsConfig(base *tls.Config) (*tls.Config, error) {
+	if c.TLSCA == "" && c.TLSCert == "" && c.TLSKey == "" && !c.TLSSkipVerify {
+		return base, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if base != nil {
+		tlsConfig = base.Clone()
+	}
+	tlsConfig.InsecureSkipVerify = c.TLSSkipVerify
+
+	if c.TLSCA != "" {
+		pem, err := os.ReadFile(c.TLSCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in TLS CA %s", c.TLSCA)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.TLSCert != "" || c.TLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(c.TLSCert, c.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
 }
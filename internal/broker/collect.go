@@ -0,0 +1,287 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"fast-celery-ping/internal/protocol"
+)
+
+// CollectionStrategy controls when reply collection stops
+type CollectionStrategy string
+
+const (
+	// CollectionGreedy stops shortly after replies stop arriving
+	CollectionGreedy CollectionStrategy = "greedy"
+	// CollectionPatient always waits for the full timeout; it is the
+	// default because staggered replies from big clusters would otherwise
+	// be cut off
+	CollectionPatient CollectionStrategy = "patient"
+)
+
+// expiresGrace is added to the collection timeout for the expiry of an
+// outgoing message, so workers still act on it until collection ends
+const expiresGrace = time.Second
+
+// messageExpiry is the expiry window for a message collected for timeout:
+// the collection window plus grace, but never less than the protocol
+// default, so workers with some clock skew or a backlog still answer. Zero
+// (unknown timeout) leaves the protocol default.
+func messageExpiry(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return 0
+	}
+	return max(protocol.DefaultMessageExpiry, timeout+expiresGrace)
+}
+
+// defaultReplyGap is how long greedy collection waits for another reply once
+// at least one worker has answered, unless configured otherwise
+const defaultReplyGap = 100 * time.Millisecond
+
+// collectReplies reads replies until the timeout expires, the context is
+// cancelled, the replies channel is closed, expected replies (when non-zero)
+// have been accepted, or - for the greedy strategy - no further reply is
+// accepted within gap (defaultReplyGap when zero) of the last accepted one.
+// handle is called for every reply and reports whether it was accepted;
+// for pings only a worker's first reply counts as accepted, so duplicates
+// and stale replies neither extend the greedy gap nor count toward expected.
+func collectReplies[T any](ctx context.Context, timeout time.Duration, strategy CollectionStrategy, gap time.Duration, expected int, replies <-chan T, handle func(T) bool) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	if gap <= 0 {
+		gap = defaultReplyGap
+	}
+
+	// The gap timer only runs for the greedy strategy after the first reply
+	gapTimer := time.NewTimer(gap)
+	gapTimer.Stop()
+	defer gapTimer.Stop()
+
+	accepted := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case <-deadline.C:
+			return nil
+
+		case reply, ok := <-replies:
+			if !ok {
+				return nil
+			}
+			if handle(reply) {
+				accepted++
+				if strategy == CollectionGreedy {
+					gapTimer.Reset(gap)
+				}
+			}
+			if expected > 0 && accepted >= expected {
+				return nil
+			}
+
+		case <-gapTimer.C:
+			return nil
+		}
+	}
+}
+
+// errEnoughResponses is the cancellation cause once MaxResponses distinct
+// workers have replied
+var errEnoughResponses = errors.New("enough responses collected")
+
+// limitResponses returns a context that record cancels once max distinct
+// workers have been recorded; max 0 disables the limit. record is safe for
+// concurrent use so the shards of one ping can share it. release must be
+// called once collection is done.
+func limitResponses(ctx context.Context, max int) (limited context.Context, record func(worker string), release func()) {
+	limited, cancel := context.WithCancelCause(ctx)
+
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	record = func(worker string) {
+		if max <= 0 {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		seen[worker] = true
+		if len(seen) >= max {
+			cancel(errEnoughResponses)
+		}
+	}
+
+	return limited, record, func() { cancel(nil) }
+}
+
+// limitErr drops the error caused by stopping at the response limit, so an
+// early stop reads as a successful collection
+func limitErr(ctx context.Context, err error) error {
+	if err != nil && errors.Is(context.Cause(ctx), errEnoughResponses) {
+		return nil
+	}
+	return err
+}
+
+// replyCounter tallies the raw size of the replies read from one reply
+// queue, to help debug message bloat in verbose mode
+type replyCounter struct {
+	debugf  func(format string, args ...interface{})
+	replies int
+	bytes   int
+}
+
+// add records a reply of size bytes, before any decoding or filtering
+func (c *replyCounter) add(size int) {
+	c.replies++
+	c.bytes += size
+	c.debugf("Reply %d: %d bytes\n", c.replies, size)
+}
+
+// summary logs the totals, e.g. "Received 4 replies, 2.1KB total"
+func (c *replyCounter) summary() {
+	c.debugf("Received %d replies, %s total\n", c.replies, formatBytes(c.bytes))
+}
+
+// formatBytes renders a byte count as B, KB or MB with one decimal
+func formatBytes(n int) string {
+	switch {
+	case n < 1024:
+		return fmt.Sprintf("%dB", n)
+	case n < 1024*1024:
+		return fmt.Sprintf("%.1fKB", float64(n)/1024)
+	default:
+		return fmt.Sprintf("%.1fMB", float64(n)/(1024*1024))
+	}
+}
+
+// addResponse stores response, keeping one entry per worker, and reports
+// whether the worker is new. A worker that already replied keeps its first
+// reply, latency included, and only has its duplicate count bumped; in
+// verbose mode the duplicate is reported as a possible misconfiguration.
+func addResponse(responses map[string]PingResponse, response PingResponse, debugf func(format string, args ...interface{})) bool {
+	first, seen := responses[response.WorkerName]
+	if !seen {
+		responses[response.WorkerName] = response
+		return true
+	}
+	first.Duplicates++
+	responses[response.WorkerName] = first
+	debugf("Warning: %s replied %d times; check for duplicate bindings or priority queues\n", response.WorkerName, first.Duplicates+1)
+	return false
+}
+
+// defaultMaxClockSkew is the clock skew warning threshold unless configured
+const defaultMaxClockSkew = 2 * time.Second
+
+// warnClockSkew reports, in verbose mode, a worker whose clock is off by
+// more than the configured threshold
+func (c Config) warnClockSkew(response PingResponse) {
+	threshold := c.MaxClockSkew
+	if threshold <= 0 {
+		threshold = defaultMaxClockSkew
+	}
+
+	skew := response.ClockSkew
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > threshold {
+		c.debugf("Warning: %s clock is off by %v (threshold %v)\n", response.WorkerName, response.ClockSkew.Round(time.Millisecond), threshold)
+	}
+}
+
+// clockSkew compares a worker-reported timestamp with the local time the
+// reply was most likely sent: halfway through the round trip
+func clockSkew(workerTime, sentAt time.Time, latency time.Duration) time.Duration {
+	return workerTime.Sub(sentAt.Add(latency / 2))
+}
+
+// parseReply decodes a raw worker reply into a PingResponse. Both pongs and
+// error replies are accepted so operators can see why a worker is unhealthy;
+// replies that do not decode or have an unknown shape are rejected with a
+// *ParseError.
+// sentAt is when the ping was published and is used to compute latency.
+func parseReply(handler *protocol.Handler, data []byte, sentAt time.Time) (PingResponse, error) {
+	response, err := handler.ParseWorkerResponse(data)
+	if err != nil {
+		return PingResponse{}, &ParseError{Data: data, Err: err}
+	}
+
+	latency := time.Since(sentAt)
+	var skew time.Duration
+	reply := handler.ClassifyReply(response)
+	if workerTime, ok := protocol.ReplyTimestamp(response, reply.WorkerName); ok {
+		skew = clockSkew(workerTime, sentAt, latency)
+	}
+
+	switch reply.Status {
+	case protocol.ReplyOK:
+		return PingResponse{
+			WorkerName: reply.WorkerName,
+			Status:     reply.OK,
+			Timestamp:  time.Now().Unix(),
+			Latency:    latency,
+			Meta:       reply.Meta,
+			Raw:        response,
+			ClockSkew:  skew,
+		}, nil
+	case protocol.ReplyError:
+		return PingResponse{
+			WorkerName: reply.WorkerName,
+			Status:     StatusError,
+			Timestamp:  time.Now().Unix(),
+			Latency:    latency,
+			Error:      reply.Error,
+			Meta:       reply.Meta,
+			Raw:        response,
+			ClockSkew:  skew,
+		}, nil
+	default:
+		return PingResponse{}, &ParseError{Data: data, Err: errUnknownReply}
+	}
+}
+
+// decodeControlEvent decodes a message seen on the pidbox; messages that do
+// not decode are dropped with a verbose note
+func decodeControlEvent(handler *protocol.Handler, source string, data []byte, debugf func(format string, args ...interface{})) (ControlEvent, bool) {
+	message, err := handler.ParseWorkerResponse(data)
+	if err != nil {
+		debugf("Dropped message on %s: %v\n", source, err)
+		return ControlEvent{}, false
+	}
+	return ControlEvent{Source: source, Received: time.Now(), Message: message}, true
+}
+
+// collectInspectReply stores the raw per-worker payload of a control reply,
+// e.g. {"worker@host": {...}} becomes replies["worker@host"] = {...}
+func collectInspectReply(handler *protocol.Handler, data []byte, replies map[string]json.RawMessage) bool {
+	response, err := handler.ParseWorkerResponse(data)
+	if err != nil {
+		return false
+	}
+
+	accepted := false
+	for workerName, value := range response {
+		if !strings.Contains(workerName, "@") {
+			continue
+		}
+
+		raw, err := json.Marshal(value)
+		if err != nil {
+			continue
+		}
+
+		replies[workerName] = raw
+		accepted = true
+	}
+
+	return accepted
+}
@@ -0,0 +1,514 @@
+package broker
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"fast-celery-ping/internal/protocol"
+)
+
+// simulateReplies sends each reply after its delay, measured from the start,
+// and leaves the channel open afterwards like a silent broker would
+func simulateReplies(delays []time.Duration) <-chan string {
+	replies := make(chan string)
+	go func() {
+		start := time.Now()
+		for i, delay := range delays {
+			time.Sleep(delay - time.Since(start))
+			replies <- string(rune('a' + i))
+		}
+	}()
+	return replies
+}
+
+func TestCollectReplies_Strategies(t *testing.T) {
+	timeout := 500 * time.Millisecond
+
+	tests := []struct {
+		name     string
+		strategy CollectionStrategy
+		delays   []time.Duration
+		minTime  time.Duration
+		maxTime  time.Duration
+		expected int
+	}{
+		{
+			name:     "greedy stops after replies dry up",
+			strategy: CollectionGreedy,
+			delays:   []time.Duration{10 * time.Millisecond, 30 * time.Millisecond},
+			minTime:  30*time.Millisecond + defaultReplyGap,
+			maxTime:  timeout - 100*time.Millisecond,
+			expected: 2,
+		},
+		{
+			name:     "empty strategy waits full timeout",
+			strategy: "",
+			delays:   []time.Duration{10 * time.Millisecond},
+			minTime:  timeout,
+			maxTime:  timeout + 200*time.Millisecond,
+			expected: 1,
+		},
+		{
+			name:     "greedy waits full timeout without replies",
+			strategy: CollectionGreedy,
+			delays:   nil,
+			minTime:  timeout,
+			maxTime:  timeout + 200*time.Millisecond,
+			expected: 0,
+		},
+		{
+			name:     "patient waits full timeout",
+			strategy: CollectionPatient,
+			delays:   []time.Duration{10 * time.Millisecond, 30 * time.Millisecond},
+			minTime:  timeout,
+			maxTime:  timeout + 200*time.Millisecond,
+			expected: 2,
+		},
+		{
+			name:     "patient catches late replies",
+			strategy: CollectionPatient,
+			delays:   []time.Duration{10 * time.Millisecond, 300 * time.Millisecond},
+			minTime:  timeout,
+			maxTime:  timeout + 200*time.Millisecond,
+			expected: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replies := simulateReplies(tt.delays)
+
+			count := 0
+			start := time.Now()
+			err := collectReplies(context.Background(), timeout, tt.strategy, 0, 0, replies, func(string) bool {
+				count++
+				return true
+			})
+			elapsed := time.Since(start)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if count != tt.expected {
+				t.Errorf("Expected %d replies, got %d", tt.expected, count)
+			}
+			if elapsed < tt.minTime || elapsed > tt.maxTime {
+				t.Errorf("Expected collection to take between %v and %v, took %v", tt.minTime, tt.maxTime, elapsed)
+			}
+		})
+	}
+}
+
+func TestCollectReplies_CustomGap(t *testing.T) {
+	timeout := time.Second
+	gap := 300 * time.Millisecond
+	replies := simulateReplies([]time.Duration{10 * time.Millisecond, 200 * time.Millisecond})
+
+	count := 0
+	start := time.Now()
+	err := collectReplies(context.Background(), timeout, CollectionGreedy, gap, 0, replies, func(string) bool {
+		count++
+		return true
+	})
+	elapsed := time.Since(start)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected the staggered reply within the gap to be collected, got %d replies", count)
+	}
+	if elapsed < 200*time.Millisecond+gap || elapsed > timeout-200*time.Millisecond {
+		t.Errorf("Expected collection to stop one gap after the last reply, took %v", elapsed)
+	}
+}
+
+func TestCollectReplies_GreedyIgnoresRejectedReplies(t *testing.T) {
+	timeout := 400 * time.Millisecond
+	replies := simulateReplies([]time.Duration{10 * time.Millisecond})
+
+	start := time.Now()
+	err := collectReplies(context.Background(), timeout, CollectionGreedy, 0, 0, replies, func(string) bool {
+		return false
+	})
+	elapsed := time.Since(start)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if elapsed < timeout {
+		t.Errorf("Expected rejected replies not to trigger early exit, returned after %v", elapsed)
+	}
+}
+
+func TestCollectReplies_GreedyGapFollowsAcceptedReplies(t *testing.T) {
+	gap := 80 * time.Millisecond
+	// One accepted reply, then rejected ones (duplicates, stale tickets)
+	// closer together than the gap
+	replies := simulateReplies([]time.Duration{10 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond, 150 * time.Millisecond, 200 * time.Millisecond})
+
+	start := time.Now()
+	err := collectReplies(context.Background(), time.Second, CollectionGreedy, gap, 0, replies, func(reply string) bool {
+		return reply == "a"
+	})
+	elapsed := time.Since(start)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if elapsed < 10*time.Millisecond+gap || elapsed > 150*time.Millisecond {
+		t.Errorf("Expected collection to stop one gap after the accepted reply, took %v", elapsed)
+	}
+}
+
+func TestCollectReplies_StopsWhenAllExpectedReplied(t *testing.T) {
+	replies := simulateReplies([]time.Duration{10 * time.Millisecond, 20 * time.Millisecond})
+
+	start := time.Now()
+	err := collectReplies(context.Background(), time.Second, CollectionPatient, 0, 2, replies, func(string) bool {
+		return true
+	})
+	elapsed := time.Since(start)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if elapsed > 200*time.Millisecond {
+		t.Errorf("Expected early return once all destinations replied, took %v", elapsed)
+	}
+}
+
+func TestCollectReplies_ClosedChannel(t *testing.T) {
+	replies := make(chan string)
+	close(replies)
+
+	start := time.Now()
+	err := collectReplies(context.Background(), time.Second, CollectionPatient, 0, 0, replies, func(string) bool {
+		return true
+	})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Expected immediate return on closed channel, took %v", elapsed)
+	}
+}
+
+func TestCollectReplies_ContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := collectReplies(ctx, time.Second, CollectionPatient, 0, 0, make(chan string), func(string) bool {
+		return true
+	})
+
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected context deadline error, got: %v", err)
+	}
+}
+
+func TestMessageExpiry(t *testing.T) {
+	tests := []struct {
+		timeout  time.Duration
+		expected time.Duration
+	}{
+		{timeout: 0, expected: 0},
+		{timeout: 1500 * time.Millisecond, expected: 10 * time.Second},
+		{timeout: 9 * time.Second, expected: 10 * time.Second},
+		{timeout: 30 * time.Second, expected: 31 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := messageExpiry(tt.timeout); got != tt.expected {
+			t.Errorf("messageExpiry(%v) = %v, expected %v", tt.timeout, got, tt.expected)
+		}
+	}
+}
+
+func TestReplyCounter(t *testing.T) {
+	var lines []string
+	counter := &replyCounter{debugf: func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}}
+
+	counter.add(1200)
+	counter.add(950)
+	counter.summary()
+
+	expected := []string{
+		"Reply 1: 1200 bytes\n",
+		"Reply 2: 950 bytes\n",
+		"Received 2 replies, 2.1KB total\n",
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected %q, got %q", expected, lines)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		bytes    int
+		expected string
+	}{
+		{0, "0B"},
+		{512, "512B"},
+		{2150, "2.1KB"},
+		{3 * 1024 * 1024, "3.0MB"},
+	}
+
+	for _, tt := range tests {
+		if got := formatBytes(tt.bytes); got != tt.expected {
+			t.Errorf("formatBytes(%d) = %q, expected %q", tt.bytes, got, tt.expected)
+		}
+	}
+}
+
+func TestAddResponse(t *testing.T) {
+	var warnings []string
+	debugf := func(format string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	responses := make(map[string]PingResponse)
+	var added []bool
+	for i, worker := range []string{"worker1@host", "worker2@host", "worker1@host", "worker1@host"} {
+		latency := time.Duration(i+1) * time.Millisecond
+		added = append(added, addResponse(responses, PingResponse{WorkerName: worker, Status: "pong", Latency: latency}, debugf))
+	}
+
+	if !reflect.DeepEqual(added, []bool{true, true, false, false}) {
+		t.Errorf("Expected only first replies to add a worker, got %v", added)
+	}
+
+	if len(responses) != 2 {
+		t.Fatalf("Expected one entry per worker, got %v", responses)
+	}
+	if dups := responses["worker1@host"].Duplicates; dups != 2 {
+		t.Errorf("Expected 2 duplicates for worker1@host, got %d", dups)
+	}
+	if latency := responses["worker1@host"].Latency; latency != time.Millisecond {
+		t.Errorf("Expected the first reply's latency to be kept, got %v", latency)
+	}
+	if dups := responses["worker2@host"].Duplicates; dups != 0 {
+		t.Errorf("Expected no duplicates for worker2@host, got %d", dups)
+	}
+
+	if len(warnings) != 2 || !strings.Contains(warnings[1], "worker1@host replied 3 times") {
+		t.Errorf("Expected a warning per duplicate reply, got %q", warnings)
+	}
+}
+
+func TestParseReply_ClockSkew(t *testing.T) {
+	sentAt := time.Now()
+	workerTime := sentAt.Add(10 * time.Second)
+	body, _ := json.Marshal(map[string]interface{}{
+		"worker1@host": map[string]interface{}{
+			"ok":        "pong",
+			"timestamp": float64(workerTime.UnixNano()) / 1e9,
+		},
+	})
+
+	response, err := parseReply(protocol.NewHandler(), body, sentAt)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if response.ClockSkew < 9*time.Second || response.ClockSkew > 10*time.Second {
+		t.Errorf("Expected about 10s of clock skew, got %v", response.ClockSkew)
+	}
+
+	var log bytes.Buffer
+	Config{DebugLog: &log, MaxClockSkew: time.Minute}.warnClockSkew(response)
+	if log.Len() != 0 {
+		t.Errorf("Expected no warning below the threshold, got %q", log.String())
+	}
+	Config{DebugLog: &log}.warnClockSkew(response)
+	if !strings.Contains(log.String(), "Warning: worker1@host clock is off by") {
+		t.Errorf("Expected a skew warning above the default threshold, got %q", log.String())
+	}
+}
+
+func TestParseReply(t *testing.T) {
+	handler := protocol.NewHandler()
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"worker1@host": map[string]interface{}{"ok": "pong"},
+	})
+	enveloped, _ := json.Marshal(map[string]interface{}{
+		"body": base64.StdEncoding.EncodeToString(body),
+	})
+
+	tests := []struct {
+		name       string
+		data       []byte
+		wantOK     bool
+		wantWorker string
+		wantStatus string
+	}{
+		{
+			name:       "raw reply",
+			data:       body,
+			wantOK:     true,
+			wantWorker: "worker1@host",
+			wantStatus: "pong",
+		},
+		{
+			name:       "enveloped reply",
+			data:       enveloped,
+			wantOK:     true,
+			wantWorker: "worker1@host",
+			wantStatus: "pong",
+		},
+		{
+			name:   "invalid JSON",
+			data:   []byte("not json"),
+			wantOK: false,
+		},
+		{
+			name:       "error reply",
+			data:       []byte(`{"worker2@host": {"error": "pool exhausted"}}`),
+			wantOK:     true,
+			wantWorker: "worker2@host",
+			wantStatus: StatusError,
+		},
+		{
+			name:   "no worker",
+			data:   []byte(`{"foo": "bar"}`),
+			wantOK: false,
+		},
+		{
+			name:   "unknown shape",
+			data:   []byte(`{"hostname": "worker@host"}`),
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := parseReply(handler, tt.data, time.Now())
+			ok := err == nil
+			if ok != tt.wantOK {
+				t.Fatalf("Expected ok=%v, got %v", tt.wantOK, err)
+			}
+			var parseErr *ParseError
+			if !ok && (!errors.As(err, &parseErr) || !bytes.Equal(parseErr.Data, tt.data)) {
+				t.Errorf("Expected a ParseError carrying the reply, got %v", err)
+			}
+			if ok && response.WorkerName != tt.wantWorker {
+				t.Errorf("Expected worker %s, got %s", tt.wantWorker, response.WorkerName)
+			}
+			if ok && response.Status != tt.wantStatus {
+				t.Errorf("Expected status %s, got %s", tt.wantStatus, response.Status)
+			}
+		})
+	}
+}
+
+func TestDecodeControlEvent(t *testing.T) {
+	handler := protocol.NewHandler()
+	enveloped, _, err := handler.CreatePingMessage("reply-queue", []string{"w1@h"}, 0, protocol.MessageFormatEnveloped)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var dropped []string
+	debugf := func(format string, args ...interface{}) {
+		dropped = append(dropped, fmt.Sprintf(format, args...))
+	}
+
+	event, ok := decodeControlEvent(handler, "/0.celery.pidbox", enveloped, debugf)
+	if !ok {
+		t.Fatalf("Expected the enveloped ping to decode, dropped: %v", dropped)
+	}
+	if event.Source != "/0.celery.pidbox" || event.Received.IsZero() {
+		t.Errorf("Expected source and receive time to be set, got %+v", event)
+	}
+	if event.Message["method"] != "ping" || !reflect.DeepEqual(event.Message["destination"], []interface{}{"w1@h"}) {
+		t.Errorf("Expected the decoded control message, got %v", event.Message)
+	}
+
+	if _, ok := decodeControlEvent(handler, "celery.pidbox", []byte("not json"), debugf); ok {
+		t.Error("Expected an undecodable message to be dropped")
+	}
+	if len(dropped) != 1 || !strings.Contains(dropped[0], "Dropped message on celery.pidbox") {
+		t.Errorf("Expected one verbose drop note, got %v", dropped)
+	}
+}
+
+func TestCollectInspectReply(t *testing.T) {
+	handler := protocol.NewHandler()
+	replies := make(map[string]json.RawMessage)
+
+	ok := collectInspectReply(handler, []byte(`{"worker1@host": {"total": {"tasks.add": 3}}}`), replies)
+	if !ok {
+		t.Fatal("Expected reply to be accepted")
+	}
+
+	var stats map[string]map[string]int
+	if err := json.Unmarshal(replies["worker1@host"], &stats); err != nil {
+		t.Fatalf("Expected raw reply to be valid JSON: %v", err)
+	}
+	if stats["total"]["tasks.add"] != 3 {
+		t.Errorf("Expected tasks.add=3, got %v", stats)
+	}
+
+	if collectInspectReply(handler, []byte(`{"foo": "bar"}`), replies) {
+		t.Error("Expected reply without worker key to be rejected")
+	}
+	if collectInspectReply(handler, []byte(`not json`), replies) {
+		t.Error("Expected invalid reply to be rejected")
+	}
+}
+
+// benchmarkRedisReply is a kombu reply envelope as a worker pushes it onto
+// the reply queue, echoing ticket
+func benchmarkRedisReply(b *testing.B, ticket string) []byte {
+	body := base64.StdEncoding.EncodeToString([]byte(`{"celery@worker-42.example.com": {"ok": "pong"}}`))
+	data, err := json.Marshal(map[string]interface{}{
+		"body":             body,
+		"content-encoding": "utf-8",
+		"content-type":     protocol.JSONContentType,
+		"headers":          map[string]interface{}{"ticket": ticket, "clock": 7},
+		"properties": map[string]interface{}{
+			"correlation_id": "b0c5a1c6-0bb8-4b5e-9d8f-0f4e3c2a1b00",
+			"reply_to":       "5d9f0c3e-7a51-3c8e-a2b4-6e1f9d0c8b7a",
+			"delivery_mode":  2,
+			"delivery_info":  map[string]interface{}{"exchange": "reply.celery.pidbox", "routing_key": "5d9f0c3e"},
+			"priority":       0,
+			"body_encoding":  "base64",
+			"delivery_tag":   "0d6a7b8c-9e0f-4a1b-8c2d-3e4f5a6b7c8d",
+		},
+	})
+	if err != nil {
+		b.Fatalf("Failed to build reply: %v", err)
+	}
+	return data
+}
+
+// BenchmarkRedisReply measures what the Redis broadcast does per reply:
+// the ticket check, then parseReply
+func BenchmarkRedisReply(b *testing.B) {
+	handler := protocol.NewHandler()
+	tickets := []string{"7c1e2f3a-4b5c-4d6e-8f90-a1b2c3d4e5f6"}
+	data := benchmarkRedisReply(b, tickets[0])
+	sentAt := time.Now()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		if !handler.ReplyMatchesAnyTicket(data, tickets...) {
+			b.Fatal("Expected the reply to match its ticket")
+		}
+		if _, err := parseReply(handler, data, sentAt); err != nil {
+			b.Fatalf("Unexpected error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package broker
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/redis/go-redis/v9"
+)
+
+// redisConnectError explains a failed Redis connection check in terms of
+// what to fix; errors it does not recognise are returned unchanged
+func redisConnectError(err error, addr string) error {
+	var redisErr redis.Error
+	if errors.As(err, &redisErr) {
+		reply := redisErr.Error()
+		switch {
+		case strings.HasPrefix(reply, "NOAUTH "):
+			return withKind(ErrAuthFailed, fmt.Errorf("authentication required: set --password or add it to the broker URL: %w", err))
+		case strings.HasPrefix(reply, "WRONGPASS "), strings.Contains(reply, "invalid password"), strings.Contains(reply, "invalid username-password pair"):
+			return withKind(ErrAuthFailed, fmt.Errorf("authentication failed: check --username and --password: %w", err))
+		case strings.Contains(reply, "without any password configured"):
+			return withKind(ErrAuthFailed, fmt.Errorf("authentication failed: the server has no password set, drop --password: %w", err))
+		}
+	}
+	if classified := networkConnectError("Redis", addr, err); classified != nil {
+		return classified
+	}
+	return err
+}
+
+// amqpConnectError explains a failed AMQP dial in terms of what to fix
+func amqpConnectError(err error, addr string) error {
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) {
+		switch {
+		case amqpErr == amqp.ErrVhost:
+			return withKind(ErrAuthFailed, fmt.Errorf("vhost access refused: check --vhost and the user's permissions: %w", err))
+		case amqpErr == amqp.ErrSASL:
+			return withKind(ErrAuthFailed, fmt.Errorf("authentication failed: no SASL mechanism the server accepts: %w", err))
+		case amqpErr.Code == amqp.AccessRefused:
+			return withKind(ErrAuthFailed, fmt.Errorf("authentication failed: check --username and --password: %w", err))
+		}
+	}
+	if classified := networkConnectError("AMQP", addr, err); classified != nil {
+		return classified
+	}
+	return fmt.Errorf("failed to connect to AMQP broker: %w", err)
+}
+
+// networkConnectError explains why the broker at addr could not be reached,
+// or returns nil for errors that are not network failures
+func networkConnectError(brokerType, addr string, err error) error {
+	var dnsErr *net.DNSError
+	var tlsErr *tls.CertificateVerificationError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &dnsErr):
+		return fmt.Errorf("cannot resolve %s host %s: check the broker URL: %w", brokerType, dnsErr.Name, err)
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return fmt.Errorf("connection refused: is %s running and listening on %s?: %w", brokerType, addr, err)
+	case errors.As(err, &tlsErr):
+		return fmt.Errorf("TLS verification of %s failed: check BROKER_TLS_CA or the URL host: %w", addr, err)
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return fmt.Errorf("timed out connecting to %s at %s: check the host and firewall, or raise --connect-timeout: %w", brokerType, addr, err)
+	}
+	return nil
+}
+
+// brokerAddr returns the host:port (or socket path) of a broker URL for
+// messages, without the credentials
+func brokerAddr(brokerURL string) string {
+	parsedURL, err := url.Parse(brokerURL)
+	if err != nil {
+		return "the broker"
+	}
+	if parsedURL.Host == "" {
+		return parsedURL.Path
+	}
+	return parsedURL.Host
+}
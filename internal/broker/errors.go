@@ -0,0 +1,59 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error kinds returned by the brokers; test for them with errors.Is. The
+// error text stays descriptive, e.g. "failed to publish ping message: ...".
+var (
+	// ErrNotConnected is returned when a broker is used before Connect
+	ErrNotConnected = errors.New("broker not connected")
+	// ErrConnectFailed is returned when Connect cannot reach the broker
+	ErrConnectFailed = errors.New("broker connection failed")
+	// ErrAuthFailed is returned, along with ErrConnectFailed, when the
+	// broker rejects the credentials
+	ErrAuthFailed = errors.New("broker authentication failed")
+	// ErrPublishFailed is returned when a control message cannot be published
+	ErrPublishFailed = errors.New("publish failed")
+)
+
+// kindError tags err with one of the error kinds above without changing its
+// message; errors.Is matches both the kind and anything err wraps
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// withKind tags err with kind, keeping its message
+func withKind(kind, err error) error {
+	return &kindError{kind: kind, err: err}
+}
+
+// ParseError is a worker reply that could not be decoded; Data holds the
+// offending bytes
+type ParseError struct {
+	Data []byte
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("failed to parse reply (%d bytes): %v", len(e.Data), e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// errUnknownReply is the ParseError cause for replies that decode but are
+// neither a pong nor an error reply
+var errUnknownReply = errors.New("not a ping reply")
@@ -0,0 +1,159 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// MockBroker implements the Broker interface without any network access.
+// It answers with programmable canned replies so code built on Broker can
+// be tested deterministically.
+type MockBroker struct {
+	// Responses are the worker replies returned by Ping
+	Responses map[string]PingResponse
+	// InspectReplies are the worker replies returned by Inspect
+	InspectReplies map[string]json.RawMessage
+	// Info is returned by ServerInfo and Diagnostics
+	Info map[string]string
+
+	// Err is returned by Ping and Inspect; ConnectErr by Connect and Health
+	Err        error
+	ConnectErr error
+
+	// Delay simulates reply latency. Workers slower than the timeout do not
+	// reply, and a context that ends first aborts the call.
+	Delay time.Duration
+
+	mu    sync.Mutex
+	calls int
+}
+
+func init() {
+	// An empty mock for integration tests; callers can type-assert to
+	// *MockBroker to program its replies
+	register("mock", func(Config) Broker { return NewMockBroker(nil) })
+}
+
+// NewMockBroker creates a mock broker answering with responses
+func NewMockBroker(responses map[string]PingResponse) *MockBroker {
+	return &MockBroker{Responses: responses}
+}
+
+// Ping returns the canned responses, restricted to destinations if given
+func (m *MockBroker) Ping(ctx context.Context, timeout time.Duration, destinations []string) (map[string]PingResponse, error) {
+	replied, err := m.wait(ctx, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make(map[string]PingResponse)
+	if !replied {
+		return responses, nil
+	}
+	for name, response := range m.Responses {
+		if targeted(name, destinations) {
+			if response.Latency == 0 {
+				response.Latency = m.Delay
+			}
+			responses[name] = response
+		}
+	}
+	return responses, nil
+}
+
+// Inspect returns the canned inspect replies, restricted to destinations if given
+func (m *MockBroker) Inspect(ctx context.Context, command string, timeout time.Duration, destinations []string) (map[string]json.RawMessage, error) {
+	replied, err := m.wait(ctx, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	replies := make(map[string]json.RawMessage)
+	if !replied {
+		return replies, nil
+	}
+	for name, reply := range m.InspectReplies {
+		if targeted(name, destinations) {
+			replies[name] = reply
+		}
+	}
+	return replies, nil
+}
+
+// Connect returns ConnectErr
+func (m *MockBroker) Connect(ctx context.Context) error {
+	return m.ConnectErr
+}
+
+// Close is a no-op
+func (m *MockBroker) Close() error {
+	return nil
+}
+
+// Health returns ConnectErr
+func (m *MockBroker) Health(ctx context.Context) error {
+	return m.ConnectErr
+}
+
+// ServerInfo returns Info
+func (m *MockBroker) ServerInfo(ctx context.Context) (map[string]string, error) {
+	if m.ConnectErr != nil {
+		return nil, m.ConnectErr
+	}
+	return m.Info, nil
+}
+
+// Diagnostics returns Info
+func (m *MockBroker) Diagnostics(ctx context.Context) (map[string]string, error) {
+	return m.ServerInfo(ctx)
+}
+
+// Calls reports how many Ping and Inspect calls the mock has served
+func (m *MockBroker) Calls() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls
+}
+
+// wait counts the call and simulates Delay. It reports whether the replies
+// arrived within timeout, or the context error if ctx ended first.
+func (m *MockBroker) wait(ctx context.Context, timeout time.Duration) (bool, error) {
+	m.mu.Lock()
+	m.calls++
+	m.mu.Unlock()
+
+	if m.Err != nil {
+		return false, m.Err
+	}
+
+	delay := m.Delay
+	if delay > timeout {
+		delay = timeout
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case <-timer.C:
+		return m.Delay <= timeout, nil
+	}
+}
+
+// targeted reports whether worker is addressed by destinations; no
+// destinations means a broadcast
+func targeted(worker string, destinations []string) bool {
+	if len(destinations) == 0 {
+		return true
+	}
+	for _, dest := range destinations {
+		if dest == worker {
+			return true
+		}
+	}
+	return false
+}
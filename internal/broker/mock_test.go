@@ -0,0 +1,154 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"fast-celery-ping/internal/config"
+)
+
+func TestMockBroker_Ping(t *testing.T) {
+	responses := map[string]PingResponse{
+		"worker1@host": {WorkerName: "worker1@host", Status: "pong"},
+		"worker2@host": {WorkerName: "worker2@host", Status: "pong"},
+	}
+
+	tests := []struct {
+		name         string
+		mock         *MockBroker
+		timeout      time.Duration
+		destinations []string
+		wantWorkers  int
+		wantErr      bool
+	}{
+		{
+			name:        "broadcast",
+			mock:        NewMockBroker(responses),
+			timeout:     time.Second,
+			wantWorkers: 2,
+		},
+		{
+			name:         "destinations filter replies",
+			mock:         NewMockBroker(responses),
+			timeout:      time.Second,
+			destinations: []string{"worker2@host", "missing@host"},
+			wantWorkers:  1,
+		},
+		{
+			name:        "delay within timeout",
+			mock:        &MockBroker{Responses: responses, Delay: 10 * time.Millisecond},
+			timeout:     time.Second,
+			wantWorkers: 2,
+		},
+		{
+			name:        "delay beyond timeout means no replies",
+			mock:        &MockBroker{Responses: responses, Delay: time.Second},
+			timeout:     10 * time.Millisecond,
+			wantWorkers: 0,
+		},
+		{
+			name:    "injected error",
+			mock:    &MockBroker{Responses: responses, Err: errors.New("connection reset")},
+			timeout: time.Second,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.mock.Ping(context.Background(), tt.timeout, tt.destinations)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(got) != tt.wantWorkers {
+				t.Errorf("Expected %d replies, got %d: %v", tt.wantWorkers, len(got), got)
+			}
+			if tt.mock.Calls() != 1 {
+				t.Errorf("Expected 1 call, got %d", tt.mock.Calls())
+			}
+		})
+	}
+}
+
+func TestMockBroker_ContextCancelled(t *testing.T) {
+	mock := &MockBroker{Delay: time.Hour}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := mock.Ping(ctx, time.Hour, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestMockBroker_Inspect(t *testing.T) {
+	mock := &MockBroker{InspectReplies: map[string]json.RawMessage{
+		"worker1@host": json.RawMessage(`{"total": {}}`),
+	}}
+
+	replies, err := mock.Inspect(context.Background(), "stats", time.Second, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(replies["worker1@host"]) != `{"total": {}}` {
+		t.Errorf("Unexpected inspect replies: %v", replies)
+	}
+}
+
+func TestMockBroker_ConnectErr(t *testing.T) {
+	var b Broker = &MockBroker{ConnectErr: errors.New("refused")}
+
+	if err := b.Connect(context.Background()); err == nil {
+		t.Error("Expected connect error")
+	}
+	if err := b.Health(context.Background()); err == nil {
+		t.Error("Expected health error")
+	}
+}
+
+// dummyBroker is a custom broker type as an external package would add it
+type dummyBroker struct {
+	*MockBroker
+	config Config
+}
+
+func TestRegister(t *testing.T) {
+	Register("dummy", func(config Config) Broker {
+		return &dummyBroker{MockBroker: NewMockBroker(nil), config: config}
+	})
+	t.Cleanup(func() {
+		registryMu.Lock()
+		delete(registry, "dummy")
+		registryMu.Unlock()
+		config.UnregisterBrokerType("dummy")
+	})
+
+	instance, err := NewBroker("dummy", Config{URL: "dummy://localhost/"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	dummy, ok := instance.(*dummyBroker)
+	if !ok {
+		t.Fatalf("Expected *dummyBroker, got %T", instance)
+	}
+	if dummy.config.URL != "dummy://localhost/" {
+		t.Errorf("Expected the config to reach the factory, got %+v", dummy.config)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering dummy twice to panic")
+		}
+	}()
+	Register("dummy", func(Config) Broker { return nil })
+}
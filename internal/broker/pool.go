@@ -0,0 +1,78 @@
+package broker
+
+import "sync"
+
+// shardDestinations splits destinations round-robin into at most n shards
+func shardDestinations(destinations []string, n int) [][]string {
+	if n > len(destinations) {
+		n = len(destinations)
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	shards := make([][]string, n)
+	for i, dest := range destinations {
+		shards[i%n] = append(shards[i%n], dest)
+	}
+	return shards
+}
+
+// defaultDestinationBatchSize caps the destinations per control message
+// unless configured otherwise
+const defaultDestinationBatchSize = 100
+
+// batchDestinations splits destinations, in order, into batches of at most
+// size (defaultDestinationBatchSize when zero). A broadcast (no
+// destinations) is a single batch of nil.
+func batchDestinations(destinations []string, size int) [][]string {
+	if size <= 0 {
+		size = defaultDestinationBatchSize
+	}
+	if len(destinations) <= size {
+		return [][]string{destinations}
+	}
+
+	batches := make([][]string, 0, (len(destinations)+size-1)/size)
+	for start := 0; start < len(destinations); start += size {
+		batches = append(batches, destinations[start:min(start+size, len(destinations))])
+	}
+	return batches
+}
+
+// fanOut runs ping for every shard with at most limit shards in flight and
+// merges the responses. The first error is returned alongside whatever
+// responses the other shards collected.
+func fanOut(shards [][]string, limit int, ping func(shard []string) (map[string]PingResponse, error)) (map[string]PingResponse, error) {
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		firstErr  error
+		responses = make(map[string]PingResponse)
+		slots     = make(chan struct{}, limit)
+	)
+
+	for _, shard := range shards {
+		wg.Add(1)
+		slots <- struct{}{}
+
+		go func(shard []string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			shardResponses, err := ping(shard)
+
+			mu.Lock()
+			defer mu.Unlock()
+			for name, response := range shardResponses {
+				responses[name] = response
+			}
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}(shard)
+	}
+
+	wg.Wait()
+	return responses, firstErr
+}
@@ -0,0 +1,169 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShardDestinations(t *testing.T) {
+	tests := []struct {
+		name         string
+		destinations []string
+		n            int
+		wantShards   int
+	}{
+		{
+			name:         "fewer destinations than workers",
+			destinations: []string{"a@h", "b@h"},
+			n:            10,
+			wantShards:   2,
+		},
+		{
+			name:         "more destinations than workers",
+			destinations: []string{"a@h", "b@h", "c@h", "d@h", "e@h"},
+			n:            2,
+			wantShards:   2,
+		},
+		{
+			name:         "no destinations",
+			destinations: nil,
+			n:            4,
+			wantShards:   0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shards := shardDestinations(tt.destinations, tt.n)
+			if len(shards) != tt.wantShards {
+				t.Fatalf("Expected %d shards, got %d", tt.wantShards, len(shards))
+			}
+
+			seen := make(map[string]bool)
+			for _, shard := range shards {
+				if len(shard) == 0 {
+					t.Error("Expected no empty shards")
+				}
+				for _, dest := range shard {
+					if seen[dest] {
+						t.Errorf("Destination %s assigned to more than one shard", dest)
+					}
+					seen[dest] = true
+				}
+			}
+			if len(seen) != len(tt.destinations) {
+				t.Errorf("Expected all %d destinations to be sharded, got %d", len(tt.destinations), len(seen))
+			}
+		})
+	}
+}
+
+func TestBatchDestinations(t *testing.T) {
+	destinations := func(n int) []string {
+		names := make([]string, n)
+		for i := range names {
+			names[i] = fmt.Sprintf("worker%d@host", i)
+		}
+		return names
+	}
+
+	tests := []struct {
+		name         string
+		destinations []string
+		size         int
+		wantSizes    []int
+	}{
+		{name: "broadcast", destinations: nil, size: 100, wantSizes: []int{0}},
+		{name: "fits in one batch", destinations: destinations(100), size: 100, wantSizes: []int{100}},
+		{name: "split with remainder", destinations: destinations(250), size: 100, wantSizes: []int{100, 100, 50}},
+		{name: "default size", destinations: destinations(101), size: 0, wantSizes: []int{100, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batches := batchDestinations(tt.destinations, tt.size)
+			if len(batches) != len(tt.wantSizes) {
+				t.Fatalf("Expected %d batches, got %d", len(tt.wantSizes), len(batches))
+			}
+
+			var joined []string
+			for i, batch := range batches {
+				if len(batch) != tt.wantSizes[i] {
+					t.Errorf("Batch %d: expected %d destinations, got %d", i, tt.wantSizes[i], len(batch))
+				}
+				joined = append(joined, batch...)
+			}
+			if len(tt.destinations) > 0 && !reflect.DeepEqual(joined, tt.destinations) {
+				t.Errorf("Expected batches to keep every destination in order, got %v", joined)
+			}
+		})
+	}
+}
+
+func TestFanOut_RespectsLimit(t *testing.T) {
+	const limit = 3
+
+	var (
+		mu       sync.Mutex
+		inFlight int
+		peak     int
+	)
+
+	shards := make([][]string, 12)
+	for i := range shards {
+		shards[i] = []string{fmt.Sprintf("worker%d@host", i)}
+	}
+
+	responses, err := fanOut(shards, limit, func(shard []string) (map[string]PingResponse, error) {
+		mu.Lock()
+		inFlight++
+		if inFlight > peak {
+			peak = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		return map[string]PingResponse{
+			shard[0]: {WorkerName: shard[0], Status: "pong"},
+		}, nil
+	})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if peak > limit {
+		t.Errorf("Expected at most %d concurrent shards, saw %d", limit, peak)
+	}
+	if len(responses) != len(shards) {
+		t.Errorf("Expected %d merged responses, got %d", len(shards), len(responses))
+	}
+}
+
+func TestFanOut_ReturnsErrorWithPartialResponses(t *testing.T) {
+	shards := [][]string{{"ok@host"}, {"bad@host"}}
+
+	responses, err := fanOut(shards, 2, func(shard []string) (map[string]PingResponse, error) {
+		if shard[0] == "bad@host" {
+			return nil, errors.New("channel closed")
+		}
+		return map[string]PingResponse{
+			shard[0]: {WorkerName: shard[0], Status: "pong"},
+		}, nil
+	})
+
+	if err == nil {
+		t.Error("Expected shard error to be returned")
+	}
+	if _, ok := responses["ok@host"]; !ok {
+		t.Error("Expected responses from healthy shards to be kept")
+	}
+}
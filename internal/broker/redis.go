@@ -2,7 +2,11 @@ package broker
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"fast-celery-ping/internal/protocol"
@@ -12,29 +16,86 @@ import (
 
 // RedisBroker implements the Broker interface for Redis
 type RedisBroker struct {
-	client  *redis.Client
+	client  redis.UniversalClient
 	config  Config
 	handler *protocol.Handler
+
+	// db is the database the client selects and the pidbox channel is
+	// prefixed with, resolved once so the two cannot disagree
+	db int
+
+	// clientMu guards client while a reply collection may replace it
+	clientMu sync.Mutex
+	// newClient and newClusterClient create the client for Connect and
+	// reconnects, the latter in cluster mode
+	newClient        func(opts *redis.Options) redis.UniversalClient
+	newClusterClient func(opts *redis.ClusterOptions) redis.UniversalClient
+}
+
+func init() {
+	register("redis", func(config Config) Broker { return NewRedisBroker(config) })
 }
 
 // NewRedisBroker creates a new Redis broker instance
 func NewRedisBroker(config Config) *RedisBroker {
-	return &RedisBroker{
+	r := &RedisBroker{
 		config:  config,
-		handler: protocol.NewHandler(),
+		handler: protocol.NewHandlerWithID(config.NodeID),
+		newClient: func(opts *redis.Options) redis.UniversalClient {
+			return redis.NewClient(opts)
+		},
+		newClusterClient: func(opts *redis.ClusterOptions) redis.UniversalClient {
+			return redis.NewClusterClient(opts)
+		},
 	}
+	r.db = r.resolveDatabase()
+	return r
 }
 
 // Connect establishes connection to Redis
 func (r *RedisBroker) Connect(ctx context.Context) error {
-	opts, err := redis.ParseURL(r.config.URL)
+	if err := configureHandler(r.handler, r.config); err != nil {
+		return err
+	}
+
+	client, err := r.dial()
 	if err != nil {
-		return fmt.Errorf("failed to parse Redis URL: %w", err)
+		return err
 	}
+	r.client = client
 
-	if r.config.Database != 0 {
-		opts.DB = r.config.Database
+	// Test connection
+	if err := r.Health(ctx); err != nil {
+		return withKind(ErrConnectFailed, redisConnectError(err, brokerAddr(r.config.URL)))
+	}
+	return nil
+}
+
+// dial creates a client from the URL and overrides: a cluster client in
+// cluster mode, a single-node client otherwise
+func (r *RedisBroker) dial() (redis.UniversalClient, error) {
+	opts, err := r.options()
+	if err != nil {
+		return nil, err
+	}
+
+	if addrs := r.clusterAddrs(); addrs != nil {
+		r.config.debugf("Using Redis cluster mode with seed nodes %v\n", addrs)
+		return r.newClusterClient(clusterOptions(opts, addrs)), nil
 	}
+	return r.newClient(opts), nil
+}
+
+// options builds the go-redis client options from the URL and overrides.
+// unix:///path/to/redis.sock URLs yield Network "unix" with the socket path
+// as Addr; the db/credential overrides apply to them the same way.
+func (r *RedisBroker) options() (*redis.Options, error) {
+	opts, err := redis.ParseURL(singleNodeURL(r.config.URL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
+	}
+
+	opts.DB = r.db
 	if r.config.Username != "" {
 		opts.Username = r.config.Username
 	}
@@ -42,10 +103,39 @@ func (r *RedisBroker) Connect(ctx context.Context) error {
 		opts.Password = r.config.Password
 	}
 
-	r.client = redis.NewClient(opts)
+	// Pool tuning for long-running or high-frequency use
+	if r.config.PoolSize > 0 {
+		opts.PoolSize = r.config.PoolSize
+	}
+	if r.config.MinIdleConns > 0 {
+		opts.MinIdleConns = r.config.MinIdleConns
+	}
+	if r.config.DialTimeout > 0 {
+		opts.DialTimeout = r.config.DialTimeout
+	}
+	if r.config.ReadTimeout > 0 {
+		opts.ReadTimeout = r.config.ReadTimeout
+	}
+	if r.config.WriteTimeout > 0 {
+		opts.WriteTimeout = r.config.WriteTimeout
+	}
 
-	// Test connection
-	return r.Health(ctx)
+	// Only rediss:// URLs come with a TLS config to customize
+	if opts.TLSConfig != nil {
+		if opts.TLSConfig, err = r.config.tlsConfig(opts.TLSConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	dialer, err := proxyDialer(r.config.Proxy, opts.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if dialer != nil {
+		opts.Dialer = redisProxyDial(dialer, opts.TLSConfig)
+	}
+
+	return opts, nil
 }
 
 // Close closes the Redis connection
@@ -59,110 +149,428 @@ func (r *RedisBroker) Close() error {
 // Health checks Redis connectivity
 func (r *RedisBroker) Health(ctx context.Context) error {
 	if r.client == nil {
-		return fmt.Errorf("Redis client not initialized")
+		return withKind(ErrNotConnected, fmt.Errorf("Redis client not initialized"))
 	}
 
 	return r.client.Ping(ctx).Err()
 }
 
+// redisInfoFields lists the INFO server fields reported by ServerInfo
+var redisInfoFields = []string{"redis_version", "redis_mode", "os", "arch_bits", "tcp_port"}
+
+// redisDiagnosticsFields lists the INFO server and clients fields reported
+// by Diagnostics
+var redisDiagnosticsFields = append([]string{"uptime_in_seconds", "connected_clients", "blocked_clients", "maxclients"}, redisInfoFields...)
+
+// ServerInfo reports the Redis server version and mode
+func (r *RedisBroker) ServerInfo(ctx context.Context) (map[string]string, error) {
+	if r.client == nil {
+		return nil, withKind(ErrNotConnected, fmt.Errorf("Redis client not initialized"))
+	}
+
+	raw, err := r.client.Info(ctx, "server").Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Redis INFO: %w", err)
+	}
+
+	return parseRedisInfo(raw, redisInfoFields), nil
+}
+
+// Diagnostics reports the Redis server identity and client counts
+func (r *RedisBroker) Diagnostics(ctx context.Context) (map[string]string, error) {
+	if r.client == nil {
+		return nil, withKind(ErrNotConnected, fmt.Errorf("Redis client not initialized"))
+	}
+
+	// One section per call; INFO with several sections needs Redis 7
+	var raw strings.Builder
+	for _, section := range []string{"server", "clients"} {
+		reply, err := r.client.Info(ctx, section).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to query Redis INFO %s: %w", section, err)
+		}
+		raw.WriteString(reply)
+	}
+
+	return parseRedisInfo(raw.String(), redisDiagnosticsFields), nil
+}
+
+// parseRedisInfo extracts fields from an INFO reply
+func parseRedisInfo(raw string, fields []string) map[string]string {
+	all := make(map[string]string)
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			all[key] = value
+		}
+	}
+
+	info := make(map[string]string)
+	for _, field := range fields {
+		if value, exists := all[field]; exists {
+			info[field] = value
+		}
+	}
+	return info
+}
+
 // Ping implements the Celery ping functionality for Redis
 func (r *RedisBroker) Ping(ctx context.Context, timeout time.Duration, destinations []string) (map[string]PingResponse, error) {
 	if r.client == nil {
-		return nil, fmt.Errorf("Redis client not initialized")
+		return nil, withKind(ErrNotConnected, fmt.Errorf("Redis client not initialized"))
+	}
+
+	ctx, recordResponse, release := limitResponses(ctx, r.config.MaxResponses)
+	defer release()
+
+	responses := make(map[string]PingResponse)
+	err := r.broadcast(ctx, "ping", timeout, destinations, func(data []byte, queue string, sentAt time.Time) bool {
+		response, err := parseReply(r.handler, data, sentAt)
+		if err != nil {
+			r.config.debugf("Dropped reply: %v\n", err)
+			return false
+		}
+		response.Queue = queue
+		r.config.debugf("Reply from %s on queue %q\n", response.WorkerName, queue)
+		r.config.warnClockSkew(response)
+		recordResponse(response.WorkerName)
+		return addResponse(responses, response, r.config.debugf)
+	})
+
+	return responses, limitErr(ctx, err)
+}
+
+// Inspect sends an arbitrary control command and returns each worker's raw reply
+func (r *RedisBroker) Inspect(ctx context.Context, command string, timeout time.Duration, destinations []string) (map[string]json.RawMessage, error) {
+	if r.client == nil {
+		return nil, withKind(ErrNotConnected, fmt.Errorf("Redis client not initialized"))
+	}
+
+	replies := make(map[string]json.RawMessage)
+	err := r.broadcast(ctx, command, timeout, destinations, func(data []byte, queue string, sentAt time.Time) bool {
+		return collectInspectReply(r.handler, data, replies)
+	})
+
+	return replies, err
+}
+
+// PreviewPing builds the ping message Ping would publish, without
+// connecting; implements Previewer
+func (r *RedisBroker) PreviewPing(destinations []string) (ControlPreview, error) {
+	if err := configureHandler(r.handler, r.config); err != nil {
+		return ControlPreview{}, err
+	}
+
+	replyTo := r.handler.CreateReplyQueue()
+	messageData, _, err := r.handler.CreateControlMessage("ping", nil, replyTo, destinations, messageExpiry(r.config.Timeout), protocol.MessageFormatEnveloped)
+	if err != nil {
+		return ControlPreview{}, fmt.Errorf("failed to create ping message: %w", err)
 	}
 
+	return ControlPreview{
+		Target:  r.pidboxChannel(),
+		ReplyTo: replyTo + "." + r.config.replyExchange(),
+		Body:    messageData,
+	}, nil
+}
+
+// Monitor subscribes to the pidbox channel and hands over every control
+// message published on it; implements Monitor. Replies travel through
+// per-ping lists that cannot be watched without consuming them, so only the
+// control messages themselves are seen.
+func (r *RedisBroker) Monitor(ctx context.Context, handle func(ControlEvent)) error {
+	client := r.currentClient()
+	if client == nil {
+		return withKind(ErrNotConnected, fmt.Errorf("Redis client not initialized"))
+	}
+
+	channel := r.pidboxChannel()
+	pubsub := client.Subscribe(ctx, channel)
+	defer pubsub.Close()
+
+	// Wait for the subscription to be confirmed, so a bad connection fails
+	// now rather than looking like a quiet cluster
+	if _, err := pubsub.Receive(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("failed to subscribe to %s: %w", channel, err)
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-messages:
+			if !ok {
+				return fmt.Errorf("subscription to %s closed", channel)
+			}
+			if event, ok := decodeControlEvent(r.handler, msg.Channel, []byte(msg.Payload), r.config.debugf); ok {
+				handle(event)
+			}
+		}
+	}
+}
+
+// broadcast publishes a control command and hands every reply to handle
+// until collection stops. Replies gathered before a context cancellation are
+// kept by handle; the cancellation is returned as ctx.Err(). handle also
+// gets the reply queue variant the reply was popped from.
+func (r *RedisBroker) broadcast(ctx context.Context, method string, timeout time.Duration, destinations []string, handle func(data []byte, queue string, sentAt time.Time) bool) error {
 	// Create reply queue with simple UUID format
 	replyTo := r.handler.CreateReplyQueue()
 
-	// Create ping message in enveloped format (base64 + envelope wrapper)
-	pingData, err := r.handler.CreatePingMessage(replyTo, destinations, protocol.MessageFormatEnveloped)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create ping message: %w", err)
+	// Create control messages in enveloped format (base64 + envelope
+	// wrapper), one per destination batch; they share the reply queue
+	var messages, tickets []string
+	for _, batch := range batchDestinations(destinations, r.config.DestinationBatchSize) {
+		messageData, ticket, err := r.handler.CreateControlMessage(method, nil, replyTo, batch, messageExpiry(timeout), protocol.MessageFormatEnveloped)
+		if err != nil {
+			return fmt.Errorf("failed to create %s message: %w", method, err)
+		}
+		messages = append(messages, string(messageData))
+		tickets = append(tickets, ticket)
 	}
 
-	// Use the correct reply queue format: UUID.reply.celery.pidbox
-	baseReplyQueue := replyTo + ".reply.celery.pidbox"
+	// Use the correct reply queue format: <UUID>.<reply exchange>
+	replyExchange := r.config.replyExchange()
+	baseReplyQueue := replyTo + "." + replyExchange
 
-	// Python celery listens on multiple queue variants with different priorities
-	replyQueues := []string{
-		baseReplyQueue,
-		baseReplyQueue + string([]byte{0x06, 0x16}) + "3", // priority 3
-		baseReplyQueue + string([]byte{0x06, 0x16}) + "6", // priority 6
-		baseReplyQueue + string([]byte{0x06, 0x16}) + "9", // priority 9
+	// Python celery listens on multiple queue variants with different
+	// priorities; they live in different cluster slots, so a cluster only
+	// gets the base queue
+	cluster := r.clusterAddrs() != nil
+	replyQueues := []string{baseReplyQueue}
+	if !cluster {
+		replyQueues = append(replyQueues,
+			baseReplyQueue+string([]byte{0x06, 0x16})+"3", // priority 3
+			baseReplyQueue+string([]byte{0x06, 0x16})+"6", // priority 6
+			baseReplyQueue+string([]byte{0x06, 0x16})+"9", // priority 9
+		)
 	}
 
-	// Publish the message to the broadcast channel
-	err = r.client.Publish(ctx, "/0.celery.pidbox", string(pingData)).Err()
-	if err != nil {
-		return nil, fmt.Errorf("failed to publish ping message: %w", err)
+	if r.config.DebugLog != nil && !cluster {
+		r.checkListeners(ctx)
+	}
+
+	// Publish the messages to the broadcast channel
+	sentAt := time.Now()
+	if len(messages) > 1 {
+		r.config.debugf("Sending %s to %d destinations in %d messages\n", method, len(destinations), len(messages))
+	}
+	for i, messageData := range messages {
+		err := publishWithRetry(ctx, r.config.RetryAttempts, isRetryableRedisError, r.config.debugf, func() error {
+			return r.client.Publish(ctx, r.pidboxChannel(), messageData).Err()
+		})
+		if err != nil {
+			return withKind(ErrPublishFailed, fmt.Errorf("failed to publish %s message: %w", method, err))
+		}
+		r.config.sent(method, tickets[i])
 	}
 
 	// Register reply queue binding like Python celery does
-	bindingKey := replyTo + string([]byte{0x06, 0x16, 0x06, 0x16}) + baseReplyQueue
-	err = r.client.SAdd(ctx, "_kombu.binding.reply.celery.pidbox", bindingKey).Err()
+	bindingKey := replyBindingKey(replyTo, baseReplyQueue)
+	err := r.client.SAdd(ctx, bindingSet(replyExchange), bindingKey).Err()
 	if err != nil {
-		return nil, fmt.Errorf("failed to register reply queue binding: %w", err)
+		return fmt.Errorf("failed to register reply queue binding: %w", err)
 	}
 
-	// Wait for responses using blocking pop with timeout
-	responses := make(map[string]PingResponse)
-	deadline := time.Now().Add(timeout)
-
 	// Give workers a moment to see the reply queue binding
 	time.Sleep(50 * time.Millisecond)
 
-	for time.Now().Before(deadline) {
-		// Calculate remaining time
-		remaining := time.Until(deadline)
-		if remaining <= 0 {
-			break
+	// Pop replies in the background so the collection strategy can decide
+	// when to stop independently of the blocking BRPOP calls
+	collectCtx, stopCollecting := context.WithCancel(ctx)
+	replies := make(chan redisReply)
+	go r.popReplies(collectCtx, replyQueues, replies)
+
+	// Collection only fails on context cancellation
+	counter := &replyCounter{debugf: r.config.debugf}
+	err = collectReplies(collectCtx, timeout, r.config.CollectionStrategy, r.config.EarlyExitAfter, len(destinations), replies, func(reply redisReply) bool {
+		data := []byte(reply.data)
+		counter.add(len(data))
+
+		// Reply lists outlive a run, so drop leftovers answering another
+		// run's ticket; replies without a ticket are accepted as before
+		if !r.handler.ReplyMatchesAnyTicket(data, tickets...) {
+			return false
 		}
+		return handle(data, reply.queue, sentAt)
+	})
+	stopCollecting()
+	counter.summary()
 
-		// Use 1s BRPOP timeout (Redis minimum)
-		// Never use less than 1s to avoid Redis warnings
-		brpopTimeout := 1 * time.Second
-		if remaining < brpopTimeout {
-			// If less than 1s remaining, break out of loop
-			break
+	if r.config.NoCleanup {
+		r.config.debugf("Left reply queues in place: %q\n", replyQueues)
+		r.config.debugf("Left binding %q in %s\n", bindingKey, bindingSet(replyExchange))
+		return err
+	}
+
+	// Clean up reply queue binding and queues, even if ctx was cancelled;
+	// the client may have been replaced by a reconnect
+	cleanupCtx := context.WithoutCancel(ctx)
+	client := r.currentClient()
+	client.SRem(cleanupCtx, bindingSet(replyExchange), bindingKey)
+	client.Del(cleanupCtx, replyQueues...)
+
+	return err
+}
+
+// resolveDatabase returns the Redis database to select, preferring the
+// explicit setting over the one in the URL path (redis://host/3); Redis
+// Cluster only has database 0
+func (r *RedisBroker) resolveDatabase() int {
+	if r.clusterAddrs() != nil {
+		return 0
+	}
+	if r.config.Database != 0 {
+		return r.config.Database
+	}
+	if opts, err := redis.ParseURL(singleNodeURL(r.config.URL)); err == nil {
+		return opts.DB
+	}
+	return 0
+}
+
+// pidboxChannel returns the broadcast channel workers subscribe to; kombu
+// prefixes fanout channels with the selected database ("/{db}.")
+func (r *RedisBroker) pidboxChannel() string {
+	return fmt.Sprintf("/%d.%s", r.db, r.config.pidboxExchange())
+}
+
+// checkListeners warns when nothing subscribes to the pidbox channel, which
+// usually means the URL points at a Redis (or database) Celery does not use.
+// kombu subscribes with PSUBSCRIBE, which PUBSUB NUMSUB does not count, and
+// PUBSUB NUMPAT only counts patterns server-wide, so any pattern subscriber
+// is taken as a listener. It only guides verbose runs; failures of the
+// checks themselves are ignored.
+func (r *RedisBroker) checkListeners(ctx context.Context) {
+	channel := r.pidboxChannel()
+	subscribers, err := r.client.PubSubNumSub(ctx, channel).Result()
+	if err != nil || subscribers[channel] > 0 {
+		return
+	}
+	if patterns, err := r.client.PubSubNumPat(ctx).Result(); err != nil || patterns > 0 {
+		return
+	}
+
+	bindings := bindingSet(r.config.pidboxExchange())
+	if count, err := r.client.SCard(ctx, bindings).Result(); err == nil && count == 0 {
+		r.config.debugf("Warning: no workers are listening on %s and %s is empty; is this the Celery broker and database?\n", channel, bindings)
+		return
+	}
+	r.config.debugf("Warning: no workers are listening on %s; replies are unlikely\n", channel)
+}
+
+// kombuBindingSep separates the fields of a kombu Redis binding entry
+const kombuBindingSep = "\x06\x16"
+
+// bindingSet returns the Redis set kombu reads an exchange's bindings from
+func bindingSet(exchange string) string {
+	return "_kombu.binding." + exchange
+}
+
+// replyBindingKey builds a kombu binding entry routing replies for
+// routingKey into queue. Entries have the form
+// "<routing key>\x06\x16<pattern>\x06\x16<queue>" with an empty pattern.
+func replyBindingKey(routingKey, queue string) string {
+	return routingKey + kombuBindingSep + kombuBindingSep + queue
+}
+
+// currentClient returns the client, which a reconnect may have replaced
+func (r *RedisBroker) currentClient() redis.UniversalClient {
+	r.clientMu.Lock()
+	defer r.clientMu.Unlock()
+	return r.client
+}
+
+// reconnect replaces the client with a fresh one built from the URL and
+// checks it within ctx
+func (r *RedisBroker) reconnect(ctx context.Context) (redis.UniversalClient, error) {
+	client, err := r.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	r.clientMu.Lock()
+	old := r.client
+	r.client = client
+	r.clientMu.Unlock()
+
+	old.Close()
+	return client, nil
+}
+
+// isConnectionError reports whether err is a transport failure worth a
+// reconnect, as opposed to an error reply from the Redis server
+func isConnectionError(err error) bool {
+	var redisErr redis.Error
+	return !errors.As(err, &redisErr)
+}
+
+// redisReply is one popped reply and the queue it was popped from
+type redisReply struct {
+	queue string
+	data  string
+}
+
+// popReplies blocks on the reply queues and forwards every reply until the
+// context is cancelled or Redis returns an error, then closes the channel.
+// A dropped connection (e.g. Redis restarting) is reconnected once.
+func (r *RedisBroker) popReplies(ctx context.Context, replyQueues []string, replies chan<- redisReply) {
+	defer close(replies)
+
+	client := r.currentClient()
+	reconnected := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
 		}
 
-		// BRPOP on all queue variants
-		result, err := r.client.BRPop(ctx, brpopTimeout, replyQueues...).Result()
+		// Use 1s BRPOP timeout (Redis minimum)
+		// Never use less than 1s to avoid Redis warnings
+		result, err := client.BRPop(ctx, time.Second, replyQueues...).Result()
 		if err != nil {
 			if err == redis.Nil {
 				// Timeout - continue checking
 				continue
 			}
-			// Other error - break
-			break
-		}
+			if ctx.Err() != nil || !isConnectionError(err) || reconnected {
+				return
+			}
 
-		if len(result) < 2 {
+			// The reply queues live in Redis, so replies that arrived
+			// while disconnected are still there after reconnecting
+			reconnected = true
+			r.config.debugf("Redis connection lost during collection (%v), reconnecting\n", err)
+			if client, err = r.reconnect(ctx); err != nil {
+				r.config.debugf("Redis reconnect failed: %v\n", err)
+				return
+			}
+			r.config.debugf("Reconnected to Redis, resuming collection\n")
 			continue
 		}
 
-		// Process the response
-		response, err := r.handler.ParseWorkerResponse([]byte(result[1]))
-		if err != nil {
+		if len(result) < 2 {
 			continue
 		}
 
-		if r.handler.ValidateResponse(response) {
-			workerName := r.handler.ExtractWorkerName(response)
-			if workerName != "" {
-				// Add response (map will naturally deduplicate)
-				responses[workerName] = PingResponse{
-					WorkerName: workerName,
-					Status:     "pong",
-					Timestamp:  time.Now().Unix(),
-				}
-			}
+		select {
+		// BRPOP answers with the queue that had the element, then the element
+		case replies <- redisReply{queue: result[0], data: result[1]}:
+		case <-ctx.Done():
+			return
 		}
 	}
-
-	// Clean up reply queue binding and queues
-	r.client.SRem(ctx, "_kombu.binding.reply.celery.pidbox", bindingKey)
-	r.client.Del(ctx, replyQueues...)
-
-	return responses, nil
 }
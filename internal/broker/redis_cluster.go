@@ -0,0 +1,71 @@
+package broker
+
+import (
+	"net"
+	"strings"
+
+	"fast-celery-ping/internal/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis Cluster support is best effort. Celery itself does not support
+// Redis Cluster, so in cluster mode:
+//   - PUBLISH reaches every node, but PUBSUB NUMSUB only sees one node, so
+//     the verbose no-listener check is skipped;
+//   - the reply queue variants hash to different slots and BRPOP cannot
+//     block on keys from several slots, so only the base reply queue (where
+//     replies without a priority land) is read;
+//   - cluster mode always uses database 0.
+
+// defaultRedisPort is added to cluster addresses given without a port
+const defaultRedisPort = "6379"
+
+// clusterAddrs returns the seed nodes when cluster mode is on, nil otherwise.
+// Cluster mode is on with Cluster set, with ClusterNodes given, or with
+// several comma-separated hosts in the URL; the URL hosts come first.
+func (r *RedisBroker) clusterAddrs() []string {
+	_, hosts := config.SplitURLHosts(r.config.URL)
+	if !r.config.Cluster && len(r.config.ClusterNodes) == 0 && len(hosts) < 2 {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var addrs []string
+	for _, host := range append(hosts, r.config.ClusterNodes...) {
+		if host == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(strings.Trim(host, "[]"), defaultRedisPort)
+		}
+		if !seen[host] {
+			seen[host] = true
+			addrs = append(addrs, host)
+		}
+	}
+	return addrs
+}
+
+// singleNodeURL keeps only the first of several comma-separated URL hosts,
+// so the URL can be parsed for credentials, TLS and database
+func singleNodeURL(rawURL string) string {
+	singleURL, _ := config.SplitURLHosts(rawURL)
+	return singleURL
+}
+
+// clusterOptions carries the single-node settings over to a cluster client
+func clusterOptions(opts *redis.Options, addrs []string) *redis.ClusterOptions {
+	return &redis.ClusterOptions{
+		Addrs:        addrs,
+		Dialer:       opts.Dialer,
+		Username:     opts.Username,
+		Password:     opts.Password,
+		TLSConfig:    opts.TLSConfig,
+		PoolSize:     opts.PoolSize,
+		MinIdleConns: opts.MinIdleConns,
+		DialTimeout:  opts.DialTimeout,
+		ReadTimeout:  opts.ReadTimeout,
+		WriteTimeout: opts.WriteTimeout,
+	}
+}
@@ -0,0 +1,89 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/redis/go-redis/v9"
+)
+
+// publishRetryDelay is the backoff before the first publish retry; it
+// doubles with every further attempt
+const publishRetryDelay = 100 * time.Millisecond
+
+// publishWithRetry calls publish up to attempts times (at least once) while
+// it fails with an error retryable accepts, backing off in between. It gives
+// up early, returning the last publish error, when the backoff would not fit
+// before ctx's deadline.
+func publishWithRetry(ctx context.Context, attempts int, retryable func(error) bool, debugf func(string, ...interface{}), publish func() error) error {
+	delay := publishRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := publish()
+		if err == nil || attempt >= attempts || ctx.Err() != nil || !retryable(err) {
+			return err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return err
+		}
+
+		debugf("Publish attempt %d failed: %v, retrying in %v\n", attempt, err, delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+// isNetworkError reports whether err is a transient network failure, as
+// opposed to e.g. a message the broker rejected
+func isNetworkError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// retryableRedisPrefixes are the Redis error replies for a server that is
+// busy or failing over rather than refusing the command
+var retryableRedisPrefixes = []string{"LOADING ", "READONLY ", "MASTERDOWN ", "TRYAGAIN ", "CLUSTERDOWN "}
+
+// isRetryableRedisError reports whether a failed Redis publish may succeed
+// when repeated
+func isRetryableRedisError(err error) bool {
+	if isNetworkError(err) {
+		return true
+	}
+	var redisErr redis.Error
+	if errors.As(err, &redisErr) {
+		for _, prefix := range retryableRedisPrefixes {
+			if strings.HasPrefix(redisErr.Error(), prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isRetryableAMQPError reports whether a failed AMQP publish may succeed
+// when repeated on the same channel; the server marks recoverable errors.
+// A closed channel or connection (amqp.ErrClosed) is not.
+func isRetryableAMQPError(err error) bool {
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) {
+		return amqpErr.Recover
+	}
+	return isNetworkError(err)
+}
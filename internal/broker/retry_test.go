@@ -0,0 +1,74 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestPublishWithRetry_StopsAtDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	calls := 0
+	start := time.Now()
+	err := publishWithRetry(ctx, 5, isNetworkError, func(string, ...interface{}) {}, func() error {
+		calls++
+		return io.EOF
+	})
+
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("Expected the publish error, got %v", err)
+	}
+	// The first backoff does not fit before the deadline
+	if calls != 1 {
+		t.Errorf("Expected 1 attempt, got %d", calls)
+	}
+	if elapsed := time.Since(start); elapsed > 40*time.Millisecond {
+		t.Errorf("Expected to give up without waiting, took %v", elapsed)
+	}
+}
+
+// redisReplyError is an error reply as go-redis returns it
+type redisReplyError string
+
+func (e redisReplyError) Error() string { return string(e) }
+func (redisReplyError) RedisError()     {}
+
+func TestIsRetryablePublishError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantRedis bool
+		wantAMQP  bool
+	}{
+		{name: "connection reset", err: fmt.Errorf("write: %w", syscall.ECONNRESET), wantRedis: true, wantAMQP: true},
+		{name: "network timeout", err: &net.OpError{Op: "write", Err: syscall.ETIMEDOUT}, wantRedis: true, wantAMQP: true},
+		{name: "unexpected EOF", err: io.ErrUnexpectedEOF, wantRedis: true, wantAMQP: true},
+		{name: "serialization", err: errors.New("json: unsupported type"), wantRedis: false, wantAMQP: false},
+		{name: "redis loading", err: redisReplyError("LOADING Redis is loading the dataset in memory"), wantRedis: true, wantAMQP: false},
+		{name: "redis wrong type", err: redisReplyError("WRONGTYPE Operation against a key holding the wrong kind of value"), wantRedis: false, wantAMQP: false},
+		{name: "redis client closed", err: redis.ErrClosed, wantRedis: false, wantAMQP: false},
+		{name: "amqp closed", err: amqp.ErrClosed, wantRedis: false, wantAMQP: false},
+		{name: "amqp recoverable", err: &amqp.Error{Code: amqp.ResourceLocked, Recover: true}, wantRedis: false, wantAMQP: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryableRedisError(tt.err); got != tt.wantRedis {
+				t.Errorf("isRetryableRedisError(%v) = %v, want %v", tt.err, got, tt.wantRedis)
+			}
+			if got := isRetryableAMQPError(tt.err); got != tt.wantAMQP {
+				t.Errorf("isRetryableAMQPError(%v) = %v, want %v", tt.err, got, tt.wantAMQP)
+			}
+		})
+	}
+}
@@ -1,11 +1,17 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net"
 	"net/url"
 	"os"
+	"path"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
 )
 
@@ -18,43 +24,238 @@ type Config struct {
 	Username   string
 	Password   string
 
+	// BrokerURLFile and PasswordFile name files holding the broker URL and
+	// password, so secrets stay out of process listings and the environment
+	BrokerURLFile string
+	PasswordFile  string
+
 	// Ping configuration
-	Timeout      time.Duration
-	OutputFormat string
-	Verbose      bool
-	Destination  []string
+	Timeout        time.Duration
+	ConnectTimeout time.Duration
+	OutputFormat   string
+	OutputFile     string
+	// ConsoleFormat is "summary" or "text" to also print the results to
+	// stdout while OutputFile gets OutputFormat; empty prints nothing
+	ConsoleFormat string
+	// TimestampFormat is "unix" or "rfc3339" for formats that show timestamps
+	TimestampFormat string
+	CheckOnly       bool
+	DryRun          bool // print the ping message instead of sending it
+	Full            bool // keep each worker's complete parsed reply in JSON output
+	CeleryCompat    bool // json/text output exactly as `celery inspect ping` prints it
+	IncludeOffline  bool // JSON list of every destination with an online flag
+	JSONEnvelope    bool // JSON worker map wrapped with a summary object
+	SummaryOnly     bool // only the online/requested/missing counts
+	// FormatTemplate is a text/template rendering the results in place of
+	// OutputFormat; see ParseFormatTemplate
+	FormatTemplate string
+	// Fields selects and orders the text columns or JSON keys per worker;
+	// empty keeps the default output
+	Fields      []string
+	NoCleanup   bool // leave Redis reply queues behind for debugging
+	NoColor     bool // never colorize text output, even on a terminal
+	Verbose     bool
+	Destination []string
+
+	// DefaultDomain completes destinations given without "@host"
+	DefaultDomain string
+
+	// DestinationGlobs are destinations containing glob characters; they
+	// turn the ping into a broadcast filtered with path.Match semantics
+	DestinationGlobs []string
+
+	// Exclude lists worker names or globs dropped from the results
+	Exclude []string
+
+	// DestinationTimeouts holds per-destination deadlines parsed from the
+	// extended "worker@host:500ms" destination syntax
+	DestinationTimeouts map[string]time.Duration
+
+	// Pattern and Matcher target workers by name pattern instead of
+	// explicit destinations; Matcher is "glob" or "pcre"
+	Pattern string
+	Matcher string
+
+	// NodeID is the origin named in control messages, for worker-side
+	// audit trails; empty means fast-celery-ping@<hostname>
+	NodeID string
+
+	// ReplyQueuePrefix names reply queues <prefix>.<hostname>.<pid>.<random>
+	// so broker ACLs can allow them; empty keeps random UUIDs
+	ReplyQueuePrefix string
+
+	// CollectionStrategy is "patient" (always wait the full timeout) or
+	// "greedy" (stop once no new worker replied for EarlyExitAfter)
+	CollectionStrategy string
+	EarlyExitAfter     time.Duration
+
+	// Serializer forces the reply decoder: "auto", "json" or "msgpack"
+	Serializer string
+
+	// ContentType and BodyEncoding shape outgoing control messages for
+	// workers with a different accept_content; empty keeps JSON in base64
+	ContentType  string
+	BodyEncoding string
+
+	// Wait turns a single ping into a readiness gate: ping every
+	// WaitInterval until WaitMinWorkers are online or Wait elapses.
+	// IntervalJitter randomizes each interval by up to ± that percentage.
+	Wait           time.Duration
+	WaitInterval   time.Duration
+	WaitMinWorkers int
+	IntervalJitter int
+
+	// WorkersExpected fails the run when fewer workers reply (0 disables)
+	WorkersExpected int
+
+	// MaxResponses stops collecting once this many workers replied
+	// (0 waits for all)
+	MaxResponses int
+
+	// MaxClockSkew is the worker clock skew verbose output warns about;
+	// zero keeps the default
+	MaxClockSkew time.Duration
+
+	// SlowThreshold marks replies with a higher latency as slow; zero
+	// disables it. FailOnSlow turns slow replies into exit code 2.
+	SlowThreshold time.Duration
+	FailOnSlow    bool
 
 	// Advanced options
 	MaxWorkers    int
 	RetryAttempts int
+	// DestinationBatchSize caps the destinations named in one control
+	// message; longer lists are split over several messages
+	DestinationBatchSize int
+
+	// Connection pool tuning; zero keeps the client defaults
+	PoolSize     int
+	MinIdleConns int
+	DialTimeout  time.Duration
+
+	// ReadTimeout and WriteTimeout bound Redis socket reads and writes;
+	// zero keeps the client defaults
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// Proxy is a socks5:// or socks5h:// URL to reach the broker through
+	Proxy string
+
+	// Redis Cluster mode; ClusterNodes are extra seed nodes (host:port)
+	Cluster      bool
+	ClusterNodes []string
+
+	// AMQP connection options; an empty VHost keeps the URL's vhost
+	VHost          string
+	ConnectionName string
+	Heartbeat      time.Duration
+	Locale         string
+
+	// DirectReply collects AMQP replies via RabbitMQ direct reply-to
+	DirectReply bool
+
+	// ManagementURL is the RabbitMQ HTTP management API asked how many
+	// worker queues are bound to the pidbox exchange before pinging
+	ManagementURL string
+
+	// PidboxChannel and ReplyExchange rename Celery's control exchanges;
+	// empty keeps celery.pidbox and reply.celery.pidbox
+	PidboxChannel string
+	ReplyExchange string
+
+	// TLS options for rediss:// and amqps:// URLs: a CA bundle, a client
+	// certificate/key pair and whether to skip server verification
+	TLSCA         string
+	TLSCert       string
+	TLSKey        string
+	TLSSkipVerify bool
+}
+
+// SupportedOutputFormats lists every output format the command can render.
+// Validation and help text derive from it; the formatter map in cmd is kept
+// separately and a test there checks the two match.
+var SupportedOutputFormats = []string{"json", "text", "csv", "yaml"}
+
+// SupportedFields lists the per-worker fields --fields can select
+var SupportedFields = []string{"worker", "status", "latency", "meta", "error"}
+
+// IsSupportedOutputFormat reports whether format is one of
+// SupportedOutputFormats
+func IsSupportedOutputFormat(format string) bool {
+	for _, supported := range SupportedOutputFormats {
+		if format == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateOutputFormat returns an error naming the supported formats when
+// format is not one of them
+func ValidateOutputFormat(format string) error {
+	if IsSupportedOutputFormat(format) {
+		return nil
+	}
+
+	quoted := make([]string, len(SupportedOutputFormats))
+	for i, supported := range SupportedOutputFormats {
+		quoted[i] = "'" + supported + "'"
+	}
+	last := len(quoted) - 1
+	return fmt.Errorf("output format must be %s or %s", strings.Join(quoted[:last], ", "), quoted[last])
 }
 
 // DefaultConfig returns a configuration with sensible defaults
 func DefaultConfig() *Config {
-	brokerURL := getEnvWithDefault("BROKER_URL", "redis://localhost:6379/0")
+	brokerURL := envBrokerURL()
+	if brokerURL == "" {
+		brokerURL = "redis://localhost:6379/0"
+	}
 	brokerType := DetectBrokerType(brokerURL)
 
 	return &Config{
-		BrokerURL:     brokerURL,
-		BrokerType:    brokerType,
-		Database:      0,
-		Username:      "",
-		Password:      "",
-		Timeout:       time.Second * 15 / 10, // 1.5 seconds
-		OutputFormat:  "text",
-		Verbose:       false,
-		MaxWorkers:    10,
-		RetryAttempts: 3,
+		BrokerURL:            brokerURL,
+		BrokerType:           brokerType,
+		Database:             0,
+		Username:             "",
+		Password:             "",
+		Timeout:              time.Second * 15 / 10, // 1.5 seconds
+		ConnectTimeout:       3 * time.Second,
+		OutputFormat:         "text",
+		TimestampFormat:      "rfc3339",
+		CollectionStrategy:   "patient",
+		Serializer:           "auto",
+		WaitInterval:         time.Second,
+		WaitMinWorkers:       1,
+		Heartbeat:            10 * time.Second,
+		Verbose:              false,
+		MaxWorkers:           10,
+		RetryAttempts:        3,
+		DestinationBatchSize: 100,
 	}
 }
 
 // LoadFromEnv loads configuration from environment variables
 func (c *Config) LoadFromEnv() error {
-	if brokerURL := os.Getenv("BROKER_URL"); brokerURL != "" {
+	if brokerURL := envBrokerURL(); brokerURL != "" {
 		c.BrokerURL = brokerURL
 		c.BrokerType = DetectBrokerType(brokerURL)
 	}
 
+	// An explicit broker type overrides detection; Validate rejects it if it
+	// contradicts the URL scheme
+	if brokerType := os.Getenv("BROKER_TYPE"); brokerType != "" {
+		c.BrokerType = brokerType
+	}
+
+	if vhost := os.Getenv("BROKER_VHOST"); vhost != "" {
+		c.VHost = vhost
+	}
+
+	if connectionName := os.Getenv("BROKER_CONNECTION_NAME"); connectionName != "" {
+		c.ConnectionName = connectionName
+	}
+
 	// Support generic broker username/password environment variables
 	if username := os.Getenv("BROKER_USERNAME"); username != "" {
 		c.Username = username
@@ -64,6 +265,30 @@ func (c *Config) LoadFromEnv() error {
 		c.Password = password
 	}
 
+	if brokerURLFile := os.Getenv("BROKER_URL_FILE"); brokerURLFile != "" {
+		c.BrokerURLFile = brokerURLFile
+	}
+
+	if passwordFile := os.Getenv("BROKER_PASSWORD_FILE"); passwordFile != "" {
+		c.PasswordFile = passwordFile
+	}
+
+	if tlsCA := os.Getenv("BROKER_TLS_CA"); tlsCA != "" {
+		c.TLSCA = tlsCA
+	}
+
+	if tlsCert := os.Getenv("BROKER_TLS_CERT"); tlsCert != "" {
+		c.TLSCert = tlsCert
+	}
+
+	if tlsKey := os.Getenv("BROKER_TLS_KEY"); tlsKey != "" {
+		c.TLSKey = tlsKey
+	}
+
+	if skipVerifyStr := os.Getenv("BROKER_TLS_SKIP_VERIFY"); skipVerifyStr != "" {
+		c.TLSSkipVerify = skipVerifyStr == "true" || skipVerifyStr == "1"
+	}
+
 	if dbStr := os.Getenv("BROKER_DB"); dbStr != "" {
 		if db, err := strconv.Atoi(dbStr); err == nil {
 			c.Database = db
@@ -76,10 +301,60 @@ func (c *Config) LoadFromEnv() error {
 		}
 	}
 
+	if connectTimeoutStr := os.Getenv("BROKER_CONNECT_TIMEOUT"); connectTimeoutStr != "" {
+		if connectTimeout, err := time.ParseDuration(connectTimeoutStr); err == nil {
+			c.ConnectTimeout = connectTimeout
+		}
+	}
+
 	if format := os.Getenv("OUTPUT_FORMAT"); format != "" {
 		c.OutputFormat = format
 	}
 
+	if outputFile := os.Getenv("OUTPUT_FILE"); outputFile != "" {
+		c.OutputFile = outputFile
+	}
+
+	if consoleFormat := os.Getenv("CONSOLE_FORMAT"); consoleFormat != "" {
+		c.ConsoleFormat = consoleFormat
+	}
+
+	if timestampFormat := os.Getenv("TIMESTAMP_FORMAT"); timestampFormat != "" {
+		c.TimestampFormat = timestampFormat
+	}
+
+	if strategy := os.Getenv("COLLECTION_STRATEGY"); strategy != "" {
+		c.CollectionStrategy = strategy
+	}
+
+	if serializer := os.Getenv("BROKER_SERIALIZER"); serializer != "" {
+		c.Serializer = serializer
+	}
+
+	if contentType := os.Getenv("BROKER_CONTENT_TYPE"); contentType != "" {
+		c.ContentType = contentType
+	}
+
+	if bodyEncoding := os.Getenv("BROKER_BODY_ENCODING"); bodyEncoding != "" {
+		c.BodyEncoding = bodyEncoding
+	}
+
+	// Parsed like --destination; normalizing and glob splitting happen
+	// once the flags are applied
+	if destination := envDestination(); destination != "" {
+		destinations, timeouts, err := ParseDestinations(destination)
+		if err != nil {
+			return err
+		}
+		c.Destination = destinations
+		c.DestinationTimeouts = timeouts
+	}
+
+	// https://no-color.org: any non-empty value disables color
+	if os.Getenv("NO_COLOR") != "" {
+		c.NoColor = true
+	}
+
 	if verboseStr := os.Getenv("VERBOSE"); verboseStr != "" {
 		c.Verbose = verboseStr == "true" || verboseStr == "1"
 	}
@@ -87,35 +362,432 @@ func (c *Config) LoadFromEnv() error {
 	return nil
 }
 
+// LoadSecretFiles reads BrokerURLFile and PasswordFile, if set, replacing
+// BrokerURL and Password. Errors never include the file contents.
+func (c *Config) LoadSecretFiles() error {
+	if c.BrokerURLFile != "" {
+		brokerURL, err := readSecretFile(c.BrokerURLFile)
+		if err != nil {
+			return fmt.Errorf("failed to read broker URL file: %w", err)
+		}
+		c.BrokerURL = brokerURL
+		c.BrokerType = DetectBrokerType(brokerURL)
+
+		// An explicit broker type still overrides detection
+		if brokerType := os.Getenv("BROKER_TYPE"); brokerType != "" {
+			c.BrokerType = brokerType
+		}
+	}
+
+	if c.PasswordFile != "" {
+		password, err := readSecretFile(c.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("failed to read password file: %w", err)
+		}
+		c.Password = password
+	}
+
+	return nil
+}
+
+// readSecretFile returns the whitespace-trimmed contents of path, which must
+// not be empty
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return secret, nil
+}
+
+// ParseURL is url.Parse with errors that leave the URL out, since the
+// *url.Error would repeat it, password included
+func ParseURL(rawURL string) (*url.URL, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, err
+	}
+	return parsedURL, nil
+}
+
+// RedactURL returns rawURL with any password replaced by "xxxxx", for
+// logging; a URL that does not parse is hidden entirely
+func RedactURL(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return "<invalid URL>"
+	}
+	return parsedURL.Redacted()
+}
+
 // Validate checks if the configuration is valid
 func (c *Config) Validate() error {
 	if c.BrokerURL == "" {
 		return fmt.Errorf("broker URL is required")
 	}
 
-	if _, err := url.Parse(c.BrokerURL); err != nil {
+	// url.Parse rejects the comma-separated hosts of a Redis Cluster URL,
+	// so they are checked one by one below
+	singleURL, hosts := SplitURLHosts(c.BrokerURL)
+	parsedURL, err := ParseURL(singleURL)
+	if err != nil {
 		return fmt.Errorf("invalid broker URL format: %w", err)
 	}
 
-	if c.BrokerType != "redis" && c.BrokerType != "amqp" {
-		return fmt.Errorf("unsupported broker type: %s (supported: redis, amqp)", c.BrokerType)
+	// Several comma-separated hosts seed a Redis Cluster
+	for _, host := range append(hosts, c.ClusterNodes...) {
+		if err := validateBrokerHost(host); err != nil {
+			return err
+		}
+	}
+
+	builtin := c.BrokerType == "redis" || c.BrokerType == "amqp"
+	if !builtin && !isExternalBrokerType(c.BrokerType) {
+		return fmt.Errorf("unsupported broker type: %s (supported: %s)", c.BrokerType, strings.Join(supportedBrokerTypes(), ", "))
+	}
+
+	// Externally registered brokers define their own URL schemes
+	if builtin {
+		urlType := schemeBrokerType(c.BrokerURL)
+		if urlType == "" {
+			return fmt.Errorf("unsupported broker URL scheme: %s (supported: redis, rediss, unix, amqp, amqps)", RedactURL(c.BrokerURL))
+		}
+		if urlType != c.BrokerType {
+			return fmt.Errorf("cannot use %s broker with %s URL", c.BrokerType, urlType)
+		}
 	}
 
 	if c.Timeout <= 0 {
 		return fmt.Errorf("timeout must be positive")
 	}
 
-	if c.OutputFormat != "json" && c.OutputFormat != "text" {
-		return fmt.Errorf("output format must be 'json' or 'text'")
+	if err := ValidateOutputFormat(c.OutputFormat); err != nil {
+		return err
 	}
 
 	if c.MaxWorkers <= 0 {
 		return fmt.Errorf("max workers must be positive")
 	}
 
+	if c.DestinationBatchSize < 0 {
+		return fmt.Errorf("destination batch size cannot be negative")
+	}
+
+	if c.TimestampFormat != "" && c.TimestampFormat != "unix" && c.TimestampFormat != "rfc3339" {
+		return fmt.Errorf("timestamp format must be 'unix' or 'rfc3339'")
+	}
+
+	if c.ConnectTimeout <= 0 {
+		return fmt.Errorf("connect timeout must be positive")
+	}
+
+	if c.CollectionStrategy != "greedy" && c.CollectionStrategy != "patient" {
+		return fmt.Errorf("collection strategy must be 'greedy' or 'patient'")
+	}
+
+	if c.Serializer != "auto" && c.Serializer != "json" && c.Serializer != "msgpack" {
+		return fmt.Errorf("serializer must be 'auto', 'json' or 'msgpack'")
+	}
+
+	if c.ContentType != "" && c.ContentType != "application/json" && c.ContentType != "application/x-msgpack" {
+		return fmt.Errorf("content type must be 'application/json' or 'application/x-msgpack'")
+	}
+
+	if c.BodyEncoding != "" && c.BodyEncoding != "base64" && c.BodyEncoding != "none" {
+		return fmt.Errorf("body encoding must be 'base64' or 'none'")
+	}
+
+	if c.ContentType == "application/x-msgpack" && c.BodyEncoding == "none" {
+		return fmt.Errorf("msgpack bodies require base64 body encoding")
+	}
+
+	if c.EarlyExitAfter < 0 {
+		return fmt.Errorf("early exit delay cannot be negative")
+	}
+
+	if c.EarlyExitAfter > 0 && c.CollectionStrategy == "patient" {
+		return fmt.Errorf("early exit requires the greedy collection strategy")
+	}
+
+	if c.Heartbeat < 0 {
+		return fmt.Errorf("heartbeat cannot be negative")
+	}
+
+	if c.PoolSize < 0 || c.MinIdleConns < 0 {
+		return fmt.Errorf("pool size and min idle connections cannot be negative")
+	}
+
+	if c.DialTimeout < 0 {
+		return fmt.Errorf("dial timeout cannot be negative")
+	}
+
+	if c.ReadTimeout < 0 || c.WriteTimeout < 0 {
+		return fmt.Errorf("redis read and write timeouts cannot be negative")
+	}
+
+	for _, glob := range c.DestinationGlobs {
+		if _, err := path.Match(glob, ""); err != nil {
+			return fmt.Errorf("invalid destination glob %q: %w", glob, err)
+		}
+		if _, ok := c.DestinationTimeouts[glob]; ok {
+			return fmt.Errorf("destination glob %s cannot have its own timeout", glob)
+		}
+	}
+
+	if c.Pattern != "" && (len(c.Destination) > 0 || len(c.DestinationGlobs) > 0) {
+		return fmt.Errorf("pattern and destination cannot be used together")
+	}
+
+	if c.Matcher != "" {
+		if c.Pattern == "" {
+			return fmt.Errorf("matcher requires a pattern")
+		}
+		if c.Matcher != "glob" && c.Matcher != "pcre" {
+			return fmt.Errorf("matcher must be 'glob' or 'pcre'")
+		}
+	}
+
+	for _, pattern := range c.Exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+		}
+	}
+
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return fmt.Errorf("TLS certificate and key must be given together")
+	}
+
+	usesTLS := c.TLSCA != "" || c.TLSCert != "" || c.TLSSkipVerify
+	if usesTLS && parsedURL.Scheme != "rediss" && parsedURL.Scheme != "amqps" {
+		return fmt.Errorf("TLS options require a rediss:// or amqps:// broker URL")
+	}
+
+	if c.WorkersExpected < 0 {
+		return fmt.Errorf("workers expected cannot be negative")
+	}
+
+	if c.Proxy != "" {
+		if err := validateProxyURL(c.Proxy); err != nil {
+			return err
+		}
+		if parsedURL.Scheme == "unix" {
+			return fmt.Errorf("a proxy cannot be used with a unix socket broker URL")
+		}
+	}
+
+	if c.Cluster || len(c.ClusterNodes) > 0 || len(hosts) > 1 {
+		if c.BrokerType != "redis" || parsedURL.Scheme == "unix" {
+			return fmt.Errorf("cluster mode requires a redis:// or rediss:// broker URL")
+		}
+		if c.Database != 0 {
+			return fmt.Errorf("Redis cluster mode only supports database 0")
+		}
+	}
+
+	if c.DirectReply && c.BrokerType != "amqp" {
+		return fmt.Errorf("direct reply-to requires an AMQP broker")
+	}
+
+	if c.ManagementURL != "" {
+		if c.BrokerType != "amqp" {
+			return fmt.Errorf("management URL requires an AMQP broker")
+		}
+		if err := validateManagementURL(c.ManagementURL); err != nil {
+			return err
+		}
+	}
+
+	if c.CeleryCompat && c.OutputFormat != "json" && c.OutputFormat != "text" {
+		return fmt.Errorf("celery compatible output is only available for the json and text formats")
+	}
+
+	if c.IncludeOffline {
+		if c.OutputFormat != "json" || c.CeleryCompat {
+			return fmt.Errorf("include offline is only available for the json format")
+		}
+		if len(c.Destination) == 0 {
+			return fmt.Errorf("include offline requires at least one destination")
+		}
+	}
+
+	if c.JSONEnvelope && (c.OutputFormat != "json" || c.CeleryCompat || c.IncludeOffline) {
+		return fmt.Errorf("json envelope is only available for the plain json format")
+	}
+
+	if err := c.validateFields(); err != nil {
+		return err
+	}
+
+	if c.SummaryOnly && ((c.OutputFormat != "json" && c.OutputFormat != "text") || c.CeleryCompat || c.IncludeOffline || c.JSONEnvelope || len(c.Fields) > 0) {
+		return fmt.Errorf("summary only is only available for the plain json and text formats")
+	}
+
+	if c.ConsoleFormat != "" {
+		if c.ConsoleFormat != "summary" && c.ConsoleFormat != "text" {
+			return fmt.Errorf("console format must be 'summary' or 'text'")
+		}
+		if c.OutputFile == "" {
+			return fmt.Errorf("console format requires an output file")
+		}
+	}
+
+	if c.FormatTemplate != "" {
+		if len(c.Fields) > 0 || c.IncludeOffline || c.JSONEnvelope || c.SummaryOnly || c.CeleryCompat {
+			return fmt.Errorf("format template cannot be combined with fields, include offline, json envelope, summary only or celery compatible output")
+		}
+		if _, err := ParseFormatTemplate(c.FormatTemplate); err != nil {
+			return err
+		}
+	}
+
+	if c.MaxClockSkew < 0 {
+		return fmt.Errorf("max clock skew cannot be negative")
+	}
+
+	if c.SlowThreshold < 0 {
+		return fmt.Errorf("slow threshold cannot be negative")
+	}
+
+	if c.FailOnSlow && c.SlowThreshold == 0 {
+		return fmt.Errorf("fail on slow requires a slow threshold")
+	}
+
+	if c.MaxResponses < 0 {
+		return fmt.Errorf("max responses cannot be negative")
+	}
+
+	if c.Wait < 0 {
+		return fmt.Errorf("wait cannot be negative")
+	}
+
+	if c.IntervalJitter < 0 || c.IntervalJitter > 100 {
+		return fmt.Errorf("interval jitter must be between 0 and 100 percent")
+	}
+
+	if c.Wait > 0 {
+		if c.WaitInterval <= 0 {
+			return fmt.Errorf("wait interval must be positive")
+		}
+		if c.WaitMinWorkers < 1 {
+			return fmt.Errorf("wait min workers must be at least 1")
+		}
+	}
+
 	return nil
 }
 
+// ParseList splits a comma separated list, trimming spaces and dropping
+// empty entries
+func ParseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ParseDestinations parses a comma separated destination list. Each entry may
+// carry its own timeout as a ":<duration>" suffix, e.g. "fast@h:500ms".
+// Entries whose suffix is not a valid duration are kept verbatim as names.
+func ParseDestinations(value string) ([]string, map[string]time.Duration, error) {
+	var destinations []string
+	timeouts := make(map[string]time.Duration)
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name := entry
+		if idx := strings.LastIndex(entry, ":"); idx > 0 {
+			if timeout, err := time.ParseDuration(entry[idx+1:]); err == nil {
+				if timeout <= 0 {
+					return nil, nil, fmt.Errorf("timeout for destination %s must be positive", entry[:idx])
+				}
+				name = entry[:idx]
+				timeouts[name] = timeout
+			}
+		}
+
+		destinations = append(destinations, name)
+	}
+
+	return destinations, timeouts, nil
+}
+
+// envBrokerURL returns the broker URL from the environment. BROKER_URL takes
+// precedence; Celery's own CELERY_BROKER_URL is the fallback so existing
+// Celery deployments work unchanged.
+func envBrokerURL() string {
+	if brokerURL := os.Getenv("BROKER_URL"); brokerURL != "" {
+		return brokerURL
+	}
+	return os.Getenv("CELERY_BROKER_URL")
+}
+
+// envDestination returns the comma separated destinations from the
+// environment. The tool-specific CELERY_PING_DESTINATION takes precedence
+// over the generic DESTINATION, which a container may set for other reasons.
+func envDestination() string {
+	if destination := os.Getenv("CELERY_PING_DESTINATION"); destination != "" {
+		return destination
+	}
+	return os.Getenv("DESTINATION")
+}
+
+// SplitDestinationGlobs separates exact destination names from globs, i.e.
+// destinations containing '*', '?' or '['
+func SplitDestinationGlobs(destinations []string) (names, globs []string) {
+	for _, destination := range destinations {
+		if strings.ContainsAny(destination, "*?[") {
+			globs = append(globs, destination)
+		} else {
+			names = append(names, destination)
+		}
+	}
+	return names, globs
+}
+
+// NormalizeDestinations completes worker names lacking the "@host" part,
+// which Celery would never match. With a domain, "worker1" becomes
+// "worker1@<domain>" and its entry in timeouts (if any) is renamed along;
+// without one, such names are kept and returned as malformed. Globs are
+// left alone since they can match the host part themselves.
+func NormalizeDestinations(destinations []string, timeouts map[string]time.Duration, domain string) (normalized, malformed []string) {
+	for _, destination := range destinations {
+		if strings.Contains(destination, "@") || strings.ContainsAny(destination, "*?[") {
+			normalized = append(normalized, destination)
+			continue
+		}
+
+		if domain == "" {
+			malformed = append(malformed, destination)
+			normalized = append(normalized, destination)
+			continue
+		}
+
+		name := destination + "@" + domain
+		if timeout, ok := timeouts[destination]; ok {
+			delete(timeouts, destination)
+			timeouts[name] = timeout
+		}
+		normalized = append(normalized, name)
+	}
+	return normalized, malformed
+}
+
 // getEnvWithDefault gets environment variable with a default value
 func getEnvWithDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -124,23 +796,207 @@ func getEnvWithDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
+// validateBrokerHost checks the host[:port] part of a broker URL. IPv6
+// addresses must be bracketed ("[::1]:6379") and ports must be 1-65535.
+// An empty host (e.g. unix:// socket URLs) is left to the client.
+func validateBrokerHost(host string) error {
+	if host == "" {
+		return nil
+	}
+
+	hasPort := strings.HasSuffix(host, ":") || strings.Contains(host, "]:")
+	if !strings.HasPrefix(host, "[") {
+		switch strings.Count(host, ":") {
+		case 0:
+		case 1:
+			hasPort = true
+		default:
+			return fmt.Errorf("invalid broker host %q: IPv6 addresses must be in brackets, e.g. [::1]:6379", host)
+		}
+	}
+	if !hasPort {
+		return nil
+	}
+
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return fmt.Errorf("invalid broker host %q: %w", host, err)
+	}
+	if hostname == "" {
+		return fmt.Errorf("invalid broker host %q: missing hostname", host)
+	}
+	if number, err := strconv.Atoi(port); err != nil || number < 1 || number > 65535 {
+		return fmt.Errorf("invalid broker port %q: must be between 1 and 65535", port)
+	}
+	return nil
+}
+
+// validateProxyURL accepts socks5:// and socks5h:// URLs with a host
+func validateProxyURL(proxyURL string) error {
+	parsedURL, err := ParseURL(proxyURL)
+	if err != nil {
+		return fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	if parsedURL.Scheme != "socks5" && parsedURL.Scheme != "socks5h" {
+		return fmt.Errorf("unsupported proxy scheme: %s (supported: socks5, socks5h)", parsedURL.Scheme)
+	}
+	if parsedURL.Hostname() == "" {
+		return fmt.Errorf("invalid proxy URL: missing host")
+	}
+	return validateBrokerHost(parsedURL.Host)
+}
+
+// validateManagementURL accepts http:// and https:// URLs with a host
+func validateManagementURL(managementURL string) error {
+	parsedURL, err := ParseURL(managementURL)
+	if err != nil {
+		return fmt.Errorf("invalid management URL: %w", err)
+	}
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return fmt.Errorf("unsupported management URL scheme: %s (supported: http, https)", parsedURL.Scheme)
+	}
+	if parsedURL.Hostname() == "" {
+		return fmt.Errorf("invalid management URL: missing host")
+	}
+	return nil
+}
+
 func DetectBrokerType(brokerURL string) string {
-	if brokerURL == "" {
-		return "redis" // default
+	if brokerType := schemeBrokerType(brokerURL); brokerType != "" {
+		return brokerType
+	}
+	// A URL whose scheme names a registered broker type selects it
+	if parsedURL, err := url.Parse(brokerURL); err == nil && isExternalBrokerType(strings.ToLower(parsedURL.Scheme)) {
+		return strings.ToLower(parsedURL.Scheme)
 	}
+	return "redis" // default fallback
+}
+
+var (
+	externalMu          sync.RWMutex
+	externalBrokerTypes = make(map[string]bool)
+)
 
-	parsedURL, err := url.Parse(brokerURL)
+// RegisterBrokerType lets Validate accept a broker type registered outside
+// this repository; broker.Register calls it
+func RegisterBrokerType(name string) {
+	externalMu.Lock()
+	defer externalMu.Unlock()
+	externalBrokerTypes[name] = true
+}
+
+// UnregisterBrokerType undoes RegisterBrokerType, for tests that register a
+// type temporarily
+func UnregisterBrokerType(name string) {
+	externalMu.Lock()
+	defer externalMu.Unlock()
+	delete(externalBrokerTypes, name)
+}
+
+func isExternalBrokerType(name string) bool {
+	externalMu.RLock()
+	defer externalMu.RUnlock()
+	return externalBrokerTypes[name]
+}
+
+// supportedBrokerTypes lists redis and amqp, then any registered types
+func supportedBrokerTypes() []string {
+	externalMu.RLock()
+	defer externalMu.RUnlock()
+
+	external := make([]string, 0, len(externalBrokerTypes))
+	for name := range externalBrokerTypes {
+		external = append(external, name)
+	}
+	sort.Strings(external)
+	return append([]string{"redis", "amqp"}, external...)
+}
+
+// schemeBrokerType returns the broker type implied by the URL scheme, or ""
+// when the scheme is not one we know how to talk to
+func schemeBrokerType(brokerURL string) string {
+	singleURL, _ := SplitURLHosts(brokerURL)
+	parsedURL, err := url.Parse(singleURL)
 	if err != nil {
-		return "redis" // fallback to redis if URL is invalid
+		return ""
 	}
 
-	scheme := strings.ToLower(parsedURL.Scheme)
-	switch scheme {
+	switch strings.ToLower(parsedURL.Scheme) {
 	case "amqp", "amqps":
 		return "amqp"
-	case "redis", "rediss":
+	case "redis", "rediss", "unix":
 		return "redis"
 	default:
-		return "redis" // default fallback
+		return ""
+	}
+}
+
+// SplitURLHosts separates the comma-separated hosts of a Redis Cluster URL
+// such as redis://:pw@node1:7000,node2:7001/0. It returns the URL reduced to
+// its first host, which url.Parse accepts, and every host; a URL without a
+// host (e.g. unix:///path) comes back unchanged with no hosts.
+func SplitURLHosts(rawURL string) (string, []string) {
+	schemeEnd := strings.Index(rawURL, "://")
+	if schemeEnd < 0 {
+		return rawURL, nil
+	}
+
+	rest := rawURL[schemeEnd+len("://"):]
+	authority := rest
+	if end := strings.IndexAny(rest, "/?#"); end >= 0 {
+		authority = rest[:end]
+	}
+	hostStart := strings.LastIndex(authority, "@") + 1
+	if hostStart == len(authority) {
+		return rawURL, nil
+	}
+
+	hosts := strings.Split(authority[hostStart:], ",")
+	singleURL := rawURL[:schemeEnd+len("://")] + authority[:hostStart] + hosts[0] + rest[len(authority):]
+	return singleURL, hosts
+}
+
+// templateEscaper turns the \n and \t a shell leaves in a quoted template
+// into the newline and tab they stand for
+var templateEscaper = strings.NewReplacer(`\n`, "\n", `\t`, "\t")
+
+// ParseFormatTemplate parses a --format-template, expanding \n and \t
+// escapes first
+func ParseFormatTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("format").Parse(templateEscaper.Replace(text))
+	if err != nil {
+		return nil, fmt.Errorf("invalid format template: %w", err)
 	}
+	return tmpl, nil
+}
+
+// validateFields checks that Fields names each of SupportedFields at most
+// once and that the output format can be projected
+func (c *Config) validateFields() error {
+	if len(c.Fields) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool, len(c.Fields))
+	for _, field := range c.Fields {
+		supported := false
+		for _, name := range SupportedFields {
+			if field == name {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return fmt.Errorf("unknown field: %s (supported: %s)", field, strings.Join(SupportedFields, ", "))
+		}
+		if seen[field] {
+			return fmt.Errorf("duplicate field: %s", field)
+		}
+		seen[field] = true
+	}
+
+	if (c.OutputFormat != "json" && c.OutputFormat != "text") || c.CeleryCompat || c.IncludeOffline || c.JSONEnvelope {
+		return fmt.Errorf("fields are only available for the plain json and text formats")
+	}
+	return nil
 }
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// LoadEnvFiles sets the variables from the given .env files (see
+// ParseEnvFile) in the process environment, so LoadFromEnv picks them up.
+// Variables already in the real environment are left alone; between files,
+// later ones win.
+func LoadEnvFiles(paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	merged := make(map[string]string)
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to read env file: %w", err)
+		}
+		vars, err := ParseEnvFile(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("failed to parse env file %s: %w", path, err)
+		}
+		for key, value := range vars {
+			merged[key] = value
+		}
+	}
+
+	for key, value := range merged {
+		if _, set := os.LookupEnv(key); set {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("failed to set %s from env file: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// ParseEnvFile reads KEY=VALUE lines. Blank lines and lines starting with #
+// are skipped, and an optional "export " prefix is ignored. Values may be
+// single-quoted (taken literally) or double-quoted (\n, \t, \" and \\
+// escapes expanded); an unquoted value ends at a " #" comment and is
+// trimmed.
+func ParseEnvFile(r io.Reader) (map[string]string, error) {
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineNumber)
+		}
+
+		value, err := parseEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		vars[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+// envEscaper expands the escapes allowed in double-quoted values
+var envEscaper = strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`)
+
+// parseEnvValue unquotes a value or strips its trailing comment
+func parseEnvValue(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	switch quote := value[0]; quote {
+	case '\'', '"':
+		end := closingQuote(value, quote)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated %c quote", quote)
+		}
+		if rest := strings.TrimSpace(value[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected text after closing quote: %s", rest)
+		}
+		if quote == '\'' {
+			return value[1:end], nil
+		}
+		return envEscaper.Replace(value[1:end]), nil
+	}
+
+	if comment := strings.Index(value, " #"); comment >= 0 {
+		value = value[:comment]
+	}
+	return strings.TrimSpace(value), nil
+}
+
+// closingQuote returns the index of the quote closing value[0], skipping
+// backslash-escaped ones inside double quotes, or -1
+func closingQuote(value string, quote byte) int {
+	for i := 1; i < len(value); i++ {
+		switch {
+		case quote == '"' && value[i] == '\\':
+			i++
+		case value[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
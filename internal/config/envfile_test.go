@@ -0,0 +1,127 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		expected map[string]string
+		wantErr  string
+	}{
+		{
+			name: "quoted and commented lines",
+			contents: `# broker settings
+BROKER_URL=redis://localhost:6379/0
+
+export BROKER_USERNAME = celery
+BROKER_PASSWORD="p@ss # not a comment \"quoted\""
+BROKER_VHOST='/ci\n' # literal backslash-n
+DESTINATION=w1@h,w2@h # trailing comment
+BROKER_CONNECTION_NAME="line1\nline2"
+EMPTY=
+`,
+			expected: map[string]string{
+				"BROKER_URL":             "redis://localhost:6379/0",
+				"BROKER_USERNAME":        "celery",
+				"BROKER_PASSWORD":        `p@ss # not a comment "quoted"`,
+				"BROKER_VHOST":           `/ci\n`,
+				"DESTINATION":            "w1@h,w2@h",
+				"BROKER_CONNECTION_NAME": "line1\nline2",
+				"EMPTY":                  "",
+			},
+		},
+		{
+			name:     "hash inside unquoted value",
+			contents: "BROKER_URL=redis://:pa#ss@localhost:6379/0\n",
+			expected: map[string]string{"BROKER_URL": "redis://:pa#ss@localhost:6379/0"},
+		},
+		{
+			name:     "missing equals sign",
+			contents: "# comment\nBROKER_URL\n",
+			wantErr:  "line 2: expected KEY=VALUE",
+		},
+		{
+			name:     "unterminated quote",
+			contents: `BROKER_PASSWORD="secret`,
+			wantErr:  "line 1: unterminated \" quote",
+		},
+		{
+			name:     "text after closing quote",
+			contents: `BROKER_PASSWORD='secret' extra`,
+			wantErr:  "line 1: unexpected text after closing quote: extra",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars, err := ParseEnvFile(strings.NewReader(tt.contents))
+
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(vars, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, vars)
+			}
+		})
+	}
+}
+
+func TestLoadEnvFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeEnvFile := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+
+	base := writeEnvFile("base.env", "BROKER_URL=redis://base:6379/0\nBROKER_USERNAME=base\nBROKER_VHOST=/base\n")
+	local := writeEnvFile("local.env", "BROKER_USERNAME=local\n")
+
+	for _, key := range []string{"BROKER_URL", "BROKER_USERNAME", "BROKER_VHOST"} {
+		original, set := os.LookupEnv(key)
+		defer func(key string) {
+			if set {
+				os.Setenv(key, original)
+			} else {
+				os.Unsetenv(key)
+			}
+		}(key)
+		os.Unsetenv(key)
+	}
+	os.Setenv("BROKER_VHOST", "/real")
+
+	if err := LoadEnvFiles([]string{base, local}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]string{
+		"BROKER_URL":      "redis://base:6379/0", // only in the file
+		"BROKER_USERNAME": "local",               // the later file wins
+		"BROKER_VHOST":    "/real",               // the real environment wins
+	}
+	for key, value := range expected {
+		if got := os.Getenv(key); got != value {
+			t.Errorf("Expected %s=%q, got %q", key, value, got)
+		}
+	}
+
+	err := LoadEnvFiles([]string{filepath.Join(dir, "missing.env")})
+	if err == nil || !strings.HasPrefix(err.Error(), "failed to read env file") {
+		t.Errorf("Expected read error for a missing file, got %v", err)
+	}
+}
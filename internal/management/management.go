@@ -0,0 +1,128 @@
+// Package management is a minimal client for the RabbitMQ HTTP management
+// API. It sees broker state the AMQP protocol does not expose, such as the
+// queues bound to an exchange, and is used only when asked for.
+package management
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"fast-celery-ping/internal/config"
+)
+
+// Default credentials RabbitMQ and amqp091 assume when a URL has none
+const (
+	defaultUsername = "guest"
+	defaultPassword = "guest"
+)
+
+// Client queries one management API endpoint
+type Client struct {
+	// baseURL has the credentials stripped, so errors never show them
+	baseURL  string
+	username string
+	password string
+	http     *http.Client
+}
+
+// NewClient returns a client for the API at managementURL, e.g.
+// http://rabbitmq:15672, which config.Validate has checked. Credentials come
+// from managementURL, else from brokerURL, else RabbitMQ's guest/guest.
+// timeout bounds each request.
+func NewClient(managementURL, brokerURL string, timeout time.Duration) (*Client, error) {
+	parsedURL, err := config.ParseURL(managementURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid management URL: %w", err)
+	}
+
+	client := &Client{
+		username: defaultUsername,
+		password: defaultPassword,
+		http:     &http.Client{Timeout: timeout},
+	}
+	credentials := parsedURL.User
+	if credentials == nil {
+		if brokerParsed, err := url.Parse(brokerURL); err == nil {
+			credentials = brokerParsed.User
+		}
+	}
+	if credentials != nil {
+		client.username = credentials.Username()
+		client.password, _ = credentials.Password()
+	}
+
+	parsedURL.User = nil
+	client.baseURL = strings.TrimSuffix(parsedURL.String(), "/")
+	return client, nil
+}
+
+// binding is one entry of an exchange's binding list
+type binding struct {
+	Destination     string `json:"destination"`
+	DestinationType string `json:"destination_type"`
+}
+
+// BoundQueues returns the names of the queues bound to exchange in vhost,
+// sorted; Celery workers each bind a <worker>.celery.pidbox queue to the
+// pidbox exchange
+func (c *Client) BoundQueues(ctx context.Context, vhost, exchange string) ([]string, error) {
+	endpoint := fmt.Sprintf("%s/api/exchanges/%s/%s/bindings/source", c.baseURL, url.PathEscape(vhost), url.PathEscape(exchange))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build management API request: %w", err)
+	}
+	req.SetBasicAuth(c.username, c.password)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("management API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("exchange %s not found in vhost %s", exchange, vhost)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, fmt.Errorf("management API refused user %s: %s", c.username, resp.Status)
+	default:
+		return nil, fmt.Errorf("management API returned %s", resp.Status)
+	}
+
+	var bindings []binding
+	if err := json.NewDecoder(resp.Body).Decode(&bindings); err != nil {
+		return nil, fmt.Errorf("failed to decode management API response: %w", err)
+	}
+
+	queues := make([]string, 0, len(bindings))
+	seen := make(map[string]bool, len(bindings))
+	for _, b := range bindings {
+		if b.DestinationType != "queue" || seen[b.Destination] {
+			continue
+		}
+		seen[b.Destination] = true
+		queues = append(queues, b.Destination)
+	}
+	sort.Strings(queues)
+	return queues, nil
+}
+
+// VHost returns the vhost an AMQP broker URL connects to, as amqp091 reads
+// it, unless override is set: "/" for an empty path, else the unescaped
+// path without its leading slash
+func VHost(brokerURL, override string) string {
+	if override != "" {
+		return override
+	}
+	parsedURL, err := url.Parse(brokerURL)
+	if err != nil || parsedURL.Path == "" || parsedURL.Path == "/" {
+		return "/"
+	}
+	return parsedURL.Path[1:]
+}
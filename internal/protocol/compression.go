@@ -0,0 +1,74 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Compression schemes a reply body can be inflated from
+const (
+	compressionNone = ""
+	compressionGzip = "gzip"
+	compressionZlib = "zlib"
+)
+
+// envelopeCompression returns the compression applied to an envelope's body.
+// Kombu records it in the "compression" header; the "content-encoding"
+// field is also honoured when it names a compression rather than a charset.
+func envelopeCompression(envelope rawEnvelope) (string, error) {
+	if compression := envelope.object("headers").str("compression"); compression != "" {
+		return normalizeCompression(compression)
+	}
+
+	contentEncoding := envelope.str("content-encoding")
+	switch strings.ToLower(contentEncoding) {
+	case "", "utf-8", "utf8", "binary", "ascii", "us-ascii", "7bit", "8bit":
+		return compressionNone, nil
+	}
+	return normalizeCompression(contentEncoding)
+}
+
+// normalizeCompression maps the names and MIME types used by kombu and HTTP
+// onto the schemes we can inflate
+func normalizeCompression(name string) (string, error) {
+	switch strings.ToLower(name) {
+	case "gzip", "x-gzip", "application/gzip", "application/x-gzip":
+		// kombu labels zlib output application/x-gzip, so the body is
+		// sniffed before inflating
+		return compressionGzip, nil
+	case "zlib", "deflate", "application/zlib", "application/x-zlib", "application/deflate":
+		return compressionZlib, nil
+	default:
+		return "", fmt.Errorf("unsupported body compression: %s", name)
+	}
+}
+
+// decompressBody inflates body according to compression, accepting either
+// gzip or zlib framing whichever was announced
+func decompressBody(body []byte, compression string) ([]byte, error) {
+	if compression == compressionNone {
+		return body, nil
+	}
+
+	var reader io.ReadCloser
+	var err error
+	if len(body) >= 2 && body[0] == 0x1f && body[1] == 0x8b {
+		reader, err = gzip.NewReader(bytes.NewReader(body))
+	} else {
+		reader, err = zlib.NewReader(bytes.NewReader(body))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s body: %w", compression, err)
+	}
+	defer reader.Close()
+
+	inflated, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s body: %w", compression, err)
+	}
+	return inflated, nil
+}
@@ -0,0 +1,100 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const pongBody = `{"celery@host": {"ok": "pong"}}`
+
+func gzipBase64(t *testing.T, data string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func zlibBase64(t *testing.T, data string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := zlib.NewWriter(&buf)
+	if _, err := writer.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestHandler_ParseWorkerResponse_Compressed(t *testing.T) {
+	handler := NewHandler()
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name: "gzip compression header",
+			data: fmt.Sprintf(`{"body": %q, "content-encoding": "binary", "headers": {"compression": "application/gzip"}}`, gzipBase64(t, pongBody)),
+		},
+		{
+			name: "gzip content-encoding",
+			data: fmt.Sprintf(`{"body": %q, "content-encoding": "gzip"}`, gzipBase64(t, pongBody)),
+		},
+		{
+			name: "kombu zlib labelled application/x-gzip",
+			data: fmt.Sprintf(`{"body": %q, "headers": {"compression": "application/x-gzip"}}`, zlibBase64(t, pongBody)),
+		},
+		{
+			name: "deflate content-encoding",
+			data: fmt.Sprintf(`{"body": %q, "content-encoding": "deflate"}`, zlibBase64(t, pongBody)),
+		},
+		{
+			name: "charset content-encoding is not compression",
+			data: fmt.Sprintf(`{"body": %q, "content-encoding": "utf-8"}`, base64.StdEncoding.EncodeToString([]byte(pongBody))),
+		},
+		{
+			name:    "unknown compression",
+			data:    fmt.Sprintf(`{"body": %q, "headers": {"compression": "application/x-bz2"}}`, gzipBase64(t, pongBody)),
+			wantErr: "unsupported body compression: application/x-bz2",
+		},
+		{
+			name:    "corrupt compressed body",
+			data:    fmt.Sprintf(`{"body": %q, "content-encoding": "gzip"}`, base64.StdEncoding.EncodeToString([]byte("not compressed"))),
+			wantErr: "failed to decompress gzip body",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := handler.ParseWorkerResponse([]byte(tt.data))
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if reply := handler.ClassifyReply(response); reply.Status != ReplyOK || reply.WorkerName != "celery@host" {
+				t.Errorf("Expected pong from celery@host, got %+v", reply)
+			}
+		})
+	}
+}
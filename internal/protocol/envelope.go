@@ -0,0 +1,115 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// bodyKey is how the body field of a Redis envelope appears in the JSON
+var bodyKey = []byte(`"body"`)
+
+// ticketKey is how the ticket header of a reply appears in the JSON
+var ticketKey = []byte(`"ticket"`)
+
+// rawEnvelope is a reply envelope whose values are decoded on demand; most
+// of a kombu envelope (delivery info, tags, ...) is never looked at
+type rawEnvelope map[string]json.RawMessage
+
+// str returns the string value of key, or "" when it is not a string
+func (e rawEnvelope) str(key string) string {
+	value := e[key]
+	if !isJSONString(value) {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return ""
+	}
+	return s
+}
+
+// object returns the object value of key, or nil when it is not an object
+func (e rawEnvelope) object(key string) rawEnvelope {
+	value := e[key]
+	if len(value) == 0 || value[0] != '{' {
+		return nil
+	}
+	var object rawEnvelope
+	if err := json.Unmarshal(value, &object); err != nil {
+		return nil
+	}
+	return object
+}
+
+// bodyEncoded reports whether the envelope names a body encoding; kombu
+// leaves body_encoding out of the properties for a raw body
+func (e rawEnvelope) bodyEncoded() bool {
+	_, encoded := e.object("properties")["body_encoding"]
+	return encoded
+}
+
+// decodeBody base64-decodes body, a JSON string, into buf. A body that is
+// not base64 may be sent unencoded, as kombu marks by leaving out
+// body_encoding, and is returned as-is.
+func (e rawEnvelope) decodeBody(body json.RawMessage, buf *[]byte) ([]byte, error) {
+	// base64 needs no JSON escapes, so the quoted bytes are usually the
+	// string itself
+	src := body[1 : len(body)-1]
+	if bytes.IndexByte(src, '\\') >= 0 {
+		var s string
+		if err := json.Unmarshal(body, &s); err != nil {
+			return nil, fmt.Errorf("failed to parse response envelope: %w", err)
+		}
+		src = []byte(s)
+	}
+
+	n := base64.StdEncoding.DecodedLen(len(src))
+	if cap(*buf) < n {
+		*buf = make([]byte, n)
+	}
+	decoded, err := base64.StdEncoding.Decode((*buf)[:n], src)
+	if err == nil {
+		return (*buf)[:decoded], nil
+	}
+	if e.bodyEncoded() {
+		return nil, fmt.Errorf("failed to decode base64 body: %w", err)
+	}
+
+	var raw string
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse response envelope: %w", err)
+	}
+	return []byte(raw), nil
+}
+
+// isJSONString reports whether value is a JSON string literal
+func isJSONString(value json.RawMessage) bool {
+	return len(value) >= 2 && value[0] == '"'
+}
+
+// maxPooledBodyBuffer caps the buffers kept for reuse, so one oversized
+// reply does not pin its memory for the rest of the run
+const maxPooledBodyBuffer = 64 << 10
+
+// bodyBuffers recycles the buffers reply bodies are base64-decoded into;
+// the decoders copy what they keep, so a buffer is free once parsed
+var bodyBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 1024)
+		return &buf
+	},
+}
+
+func getBodyBuffer() *[]byte {
+	return bodyBuffers.Get().(*[]byte)
+}
+
+func putBodyBuffer(buf *[]byte) {
+	if cap(*buf) > maxPooledBodyBuffer {
+		return
+	}
+	bodyBuffers.Put(buf)
+}
@@ -1,13 +1,16 @@
 package protocol
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"strings"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/vmihailenco/msgpack/v5"
 )
 
 // MessageFormat represents the format of the ping message
@@ -20,21 +23,195 @@ const (
 	MessageFormatEnveloped
 )
 
+// Supported reply serializers
+const (
+	// SerializerAuto picks the decoder from the envelope content-type
+	SerializerAuto = "auto"
+	// SerializerJSON always decodes reply bodies as JSON
+	SerializerJSON = "json"
+	// SerializerMsgpack always decodes reply bodies as msgpack
+	SerializerMsgpack = "msgpack"
+)
+
+// Content types control messages can be serialized as
+const (
+	// JSONContentType is the default, what celery's CLI sends
+	JSONContentType = "application/json"
+	// MsgpackContentType is the content-type kombu uses for msgpack bodies
+	MsgpackContentType = "application/x-msgpack"
+)
+
+// Body encodings of an enveloped (Redis) message
+const (
+	// BodyEncodingBase64 base64-encodes the body, as kombu does
+	BodyEncodingBase64 = "base64"
+	// BodyEncodingNone embeds the serialized body as-is and leaves
+	// body_encoding out of the properties
+	BodyEncodingNone = "none"
+)
+
 // Handler manages Celery protocol operations
 type Handler struct {
-	nodeID string
+	nodeID     string
+	serializer string
+	pattern    string
+	matcher    string
+
+	// contentType and bodyEncoding shape outgoing messages; see
+	// SetMessageEncoding
+	contentType  string
+	bodyEncoding string
+
+	// replyQueuePrefix makes reply queue names predictable; see
+	// SetReplyQueuePrefix
+	replyQueuePrefix string
+
+	// pidboxExchange receives control broadcasts; replyExchange is named
+	// in reply_to so workers know where to answer
+	pidboxExchange string
+	replyExchange  string
 }
 
-// NewHandler creates a new protocol handler
+// Default kombu exchange names for Celery's "celery" pidbox namespace
+const (
+	DefaultPidboxExchange = "celery.pidbox"
+	DefaultReplyExchange  = "reply.celery.pidbox"
+)
+
+// NewHandler creates a new protocol handler whose control messages name
+// fast-celery-ping@<hostname> as their origin
 func NewHandler() *Handler {
+	return NewHandlerWithID("")
+}
+
+// NewHandlerWithID creates a protocol handler whose control messages name
+// nodeID as their origin, e.g. "deploy-check@ci"; empty keeps the default
+func NewHandlerWithID(nodeID string) *Handler {
+	if nodeID == "" {
+		nodeID = fmt.Sprintf("fast-celery-ping@%s", generateHostname())
+	}
 	return &Handler{
-		nodeID: fmt.Sprintf("fast-celery-ping@%s", generateHostname()),
+		nodeID:         nodeID,
+		contentType:    JSONContentType,
+		bodyEncoding:   BodyEncodingBase64,
+		pidboxExchange: DefaultPidboxExchange,
+		replyExchange:  DefaultReplyExchange,
+	}
+}
+
+// SetSerializer forces the decoder used for reply bodies; an empty name or
+// SerializerAuto detects it from the envelope content-type
+func (h *Handler) SetSerializer(serializer string) error {
+	switch serializer {
+	case "", SerializerAuto:
+		h.serializer = ""
+	case SerializerJSON, SerializerMsgpack:
+		h.serializer = serializer
+	default:
+		return fmt.Errorf("unsupported serializer: %s", serializer)
+	}
+	return nil
+}
+
+// SetMessageEncoding sets the content-type control messages are serialized
+// as (JSONContentType or MsgpackContentType) and how an enveloped message
+// carries its body (BodyEncodingBase64 or BodyEncodingNone), to match what
+// the workers accept. Empty values keep the defaults, JSON in base64.
+func (h *Handler) SetMessageEncoding(contentType, bodyEncoding string) error {
+	switch contentType {
+	case "":
+		contentType = JSONContentType
+	case JSONContentType, MsgpackContentType:
+	default:
+		return fmt.Errorf("unsupported content type: %s (supported: %s, %s)", contentType, JSONContentType, MsgpackContentType)
+	}
+	switch bodyEncoding {
+	case "":
+		bodyEncoding = BodyEncodingBase64
+	case BodyEncodingBase64, BodyEncodingNone:
+	default:
+		return fmt.Errorf("unsupported body encoding: %s (supported: %s, %s)", bodyEncoding, BodyEncodingBase64, BodyEncodingNone)
+	}
+	if contentType == MsgpackContentType && bodyEncoding == BodyEncodingNone {
+		return fmt.Errorf("msgpack bodies require %s body encoding", BodyEncodingBase64)
+	}
+
+	h.contentType = contentType
+	h.bodyEncoding = bodyEncoding
+	return nil
+}
+
+// ContentType is the content-type control messages are serialized as
+func (h *Handler) ContentType() string {
+	return h.contentType
+}
+
+// SetPattern targets broadcasts at workers whose name matches pattern
+// instead of explicit destinations. matcher is "glob" or "pcre"; empty
+// leaves the choice to the worker (kombu defaults to glob).
+func (h *Handler) SetPattern(pattern, matcher string) error {
+	switch matcher {
+	case "", "glob", "pcre":
+	default:
+		return fmt.Errorf("unsupported matcher: %s (supported: glob, pcre)", matcher)
+	}
+	if matcher != "" && pattern == "" {
+		return fmt.Errorf("matcher requires a pattern")
 	}
+
+	h.pattern = pattern
+	h.matcher = matcher
+	return nil
+}
+
+// SetExchanges overrides the pidbox and reply exchange names written into
+// control messages; empty names keep the defaults
+func (h *Handler) SetExchanges(pidboxExchange, replyExchange string) {
+	h.pidboxExchange = DefaultPidboxExchange
+	if pidboxExchange != "" {
+		h.pidboxExchange = pidboxExchange
+	}
+	h.replyExchange = DefaultReplyExchange
+	if replyExchange != "" {
+		h.replyExchange = replyExchange
+	}
+}
+
+// SetReplyQueuePrefix names reply queues <prefix>.<hostname>.<pid>.<random>
+// instead of a bare UUID, so broker ACLs can allow "<prefix>.*". The short
+// random suffix keeps concurrent runs on one host apart. An empty prefix
+// keeps the UUIDs.
+func (h *Handler) SetReplyQueuePrefix(prefix string) {
+	h.replyQueuePrefix = prefix
+}
+
+// DefaultMessageExpiry is how long an enveloped message stays valid when no
+// expiry window is given
+const DefaultMessageExpiry = 10 * time.Second
+
+// unixSeconds is t as fractional Unix seconds, like Python's time.time()
+// that kombu compares the expires header with
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
 }
 
 // CreatePingMessage creates a Celery ping message in the specified format
-func (h *Handler) CreatePingMessage(replyTo string, destinations []string, format MessageFormat) ([]byte, error) {
-	ticket := uuid.New().String()
+func (h *Handler) CreatePingMessage(replyTo string, destinations []string, expires time.Duration, format MessageFormat) ([]byte, string, error) {
+	return h.CreateControlMessage("ping", nil, replyTo, destinations, expires, format)
+}
+
+// CreateControlMessage creates a Celery control message for method (e.g.
+// "ping", "stats", "registered") in the specified format. It also returns
+// the message ticket, which workers echo back in their replies. expires is
+// how long workers should still act on an enveloped message, normally the
+// collection window; zero means DefaultMessageExpiry. Raw messages carry no
+// expiry.
+func (h *Handler) CreateControlMessage(method string, arguments map[string]interface{}, replyTo string, destinations []string, expires time.Duration, format MessageFormat) ([]byte, string, error) {
+	ticket := newID()
+
+	if arguments == nil {
+		arguments = map[string]interface{}{}
+	}
 
 	// Determine destination - nil for broadcast, or specific destinations
 	var destination interface{}
@@ -44,97 +221,226 @@ func (h *Handler) CreatePingMessage(replyTo string, destinations []string, forma
 		destination = nil
 	}
 
-	// Create the control message that Celery workers expect
+	// Pattern and matcher are nil unless pattern targeting is configured
+	var pattern, matcher interface{}
+	if h.pattern != "" {
+		pattern = h.pattern
+	}
+	if h.matcher != "" {
+		matcher = h.matcher
+	}
+
+	// Create the control message that Celery workers expect; kombu passes
+	// unknown keys such as origin through without complaint
 	controlMessage := map[string]interface{}{
-		"method":      "ping",
-		"arguments":   map[string]interface{}{},
+		"origin":      h.nodeID,
+		"method":      method,
+		"arguments":   arguments,
 		"destination": destination,
-		"pattern":     nil,
-		"matcher":     nil,
+		"pattern":     pattern,
+		"matcher":     matcher,
 		"ticket":      ticket,
 		"reply_to": map[string]interface{}{
-			"exchange":    "reply.celery.pidbox",
+			"exchange":    h.replyExchange,
 			"routing_key": replyTo,
 		},
 	}
 
+	bodyBytes, err := h.serialize(controlMessage)
+	if err != nil {
+		return nil, "", err
+	}
+
 	// Apply format-specific processing
 	switch format {
 	case MessageFormatRaw:
-		// Return the control message directly as JSON (used by AMQP)
-		return json.Marshal(controlMessage)
+		// Return the serialized control message directly (used by AMQP)
+		return bodyBytes, ticket, nil
 	case MessageFormatEnveloped:
-		// Base64 encode the control message and wrap in envelope (used by Redis)
-		bodyBytes, err := json.Marshal(controlMessage)
-		if err != nil {
-			return nil, err
+		// Wrap the control message in an envelope (used by Redis),
+		// base64-encoding the body like Python Celery does unless asked not to
+		body := string(bodyBytes)
+		if h.bodyEncoding == BodyEncodingBase64 {
+			body = base64.StdEncoding.EncodeToString(bodyBytes)
 		}
 
-		// Base64 encode the body like Python Celery does
-		base64Body := base64.StdEncoding.EncodeToString(bodyBytes)
-
-		// Set expiry to 10 seconds to ensure workers have time to respond
-		now := time.Now()
-		expires := now.Add(10 * time.Second).Unix()
+		// Workers drop the message once it expires, so the window must
+		// cover the whole collection
+		if expires <= 0 {
+			expires = DefaultMessageExpiry
+		}
 
 		// Create the complete message envelope matching Python Celery exactly
 		envelope := map[string]interface{}{
-			"body":             base64Body,
+			"body":             body,
 			"content-encoding": "utf-8",
-			"content-type":     "application/json",
+			"content-type":     h.contentType,
 			"headers": map[string]interface{}{
 				"clock":   1,
-				"expires": expires,
+				"expires": unixSeconds(time.Now().Add(expires)),
 			},
 			"properties": map[string]interface{}{
 				"delivery_mode": 2,
 				"delivery_info": map[string]interface{}{
-					"exchange":    "celery.pidbox",
+					"exchange":    h.pidboxExchange,
 					"routing_key": "",
 				},
 				"priority":      0,
 				"body_encoding": "base64",
-				"delivery_tag":  uuid.New().String(),
+				"delivery_tag":  newID(),
 			},
 		}
 
-		return json.Marshal(envelope)
+		if h.bodyEncoding != BodyEncodingBase64 {
+			// kombu only knows base64; a missing body_encoding means none
+			delete(envelope["properties"].(map[string]interface{}), "body_encoding")
+		}
+
+		data, err := json.Marshal(envelope)
+		return data, ticket, err
 	default:
-		return nil, fmt.Errorf("unsupported message format: %v", format)
+		return nil, "", fmt.Errorf("unsupported message format: %v", format)
+	}
+}
+
+// serialize encodes an outgoing control message as the configured
+// content-type
+func (h *Handler) serialize(message map[string]interface{}) ([]byte, error) {
+	if h.contentType == MsgpackContentType {
+		return msgpack.Marshal(message)
 	}
+	return json.Marshal(message)
 }
 
 // ParseWorkerResponse parses a worker response and extracts relevant information
 func (h *Handler) ParseWorkerResponse(data []byte) (map[string]interface{}, error) {
-	var envelope map[string]interface{}
+	// Only a Redis envelope has a body to unwrap; anything else, such as
+	// an AMQP reply, is decoded straight into the map returned
+	if !bytes.Contains(data, bodyKey) {
+		return h.parseBare(data)
+	}
 
-	// Parse the response envelope
+	// Parse the response envelope, leaving its values undecoded until needed
+	var envelope rawEnvelope
 	if err := json.Unmarshal(data, &envelope); err != nil {
-		return nil, fmt.Errorf("failed to parse response envelope: %w", err)
+		if isArrayError(err) {
+			// An array reply has no envelope, whatever its elements hold
+			return h.parseBare(data)
+		}
+		return h.parseNonJSON(data, err)
 	}
 
-	// Check if there's a base64-encoded body
-	if bodyStr, exists := envelope["body"]; exists {
-		if bodyString, ok := bodyStr.(string); ok {
-			// Decode base64 body
-			bodyBytes, err := base64.StdEncoding.DecodeString(bodyString)
-			if err != nil {
-				return nil, fmt.Errorf("failed to decode base64 body: %w", err)
-			}
+	body, exists := envelope["body"]
+	if !exists || !isJSONString(body) {
+		// Fallback: return the envelope as-is
+		return h.parseBare(data)
+	}
 
-			// Parse the decoded body as JSON
-			var decodedBody map[string]interface{}
-			if err := json.Unmarshal(bodyBytes, &decodedBody); err != nil {
-				return nil, fmt.Errorf("failed to parse decoded body: %w", err)
-			}
+	buf := getBodyBuffer()
+	defer putBodyBuffer(buf)
+
+	bodyBytes, err := envelope.decodeBody(body, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	compression, err := envelopeCompression(envelope)
+	if err != nil {
+		return nil, err
+	}
+	if bodyBytes, err = decompressBody(bodyBytes, compression); err != nil {
+		return nil, err
+	}
+
+	if h.bodySerializer(envelope.str("content-type")) == SerializerMsgpack {
+		return decodeMsgpack(bodyBytes)
+	}
 
-			// Return the decoded body as the main response
-			return decodedBody, nil
+	// Parse the decoded body as JSON
+	decodedBody, err := unmarshalReply(bodyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse decoded body: %w", err)
+	}
+
+	// Return the decoded body as the main response
+	return decodedBody, nil
+}
+
+// parseBare decodes a reply that has no envelope to unwrap
+func (h *Handler) parseBare(data []byte) (map[string]interface{}, error) {
+	response, err := unmarshalReply(data)
+	if err != nil {
+		return h.parseNonJSON(data, err)
+	}
+	return response, nil
+}
+
+// unmarshalReply decodes a JSON reply object. A reply that is an array of
+// objects, such as [{"w1@h": {"ok": "pong"}}], has its elements merged into
+// one map, later keys winning.
+func unmarshalReply(data []byte) (map[string]interface{}, error) {
+	var response map[string]interface{}
+	err := json.Unmarshal(data, &response)
+	if err == nil || !isArrayError(err) {
+		return response, err
+	}
+
+	var elements []map[string]interface{}
+	if err := json.Unmarshal(data, &elements); err != nil {
+		return nil, err
+	}
+	response = make(map[string]interface{}, len(elements))
+	for _, element := range elements {
+		for key, value := range element {
+			response[key] = value
 		}
 	}
+	return response, nil
+}
 
-	// Fallback: return the envelope as-is
-	return envelope, nil
+// isArrayError reports whether err is json.Unmarshal refusing a top-level
+// array where an object was expected
+func isArrayError(err error) bool {
+	var typeErr *json.UnmarshalTypeError
+	return errors.As(err, &typeErr) && typeErr.Value == "array" && typeErr.Field == ""
+}
+
+// parseNonJSON decodes a reply that failed to parse as JSON with err
+func (h *Handler) parseNonJSON(data []byte, err error) (map[string]interface{}, error) {
+	// AMQP delivers msgpack replies without a JSON envelope
+	if h.serializer == SerializerMsgpack || (h.serializer == "" && looksLikeMsgpackMap(data)) {
+		return decodeMsgpack(data)
+	}
+	return nil, fmt.Errorf("failed to parse response envelope: %w", err)
+}
+
+// bodySerializer picks the decoder for an enveloped body
+func (h *Handler) bodySerializer(contentType string) string {
+	if h.serializer != "" {
+		return h.serializer
+	}
+	if strings.EqualFold(contentType, MsgpackContentType) {
+		return SerializerMsgpack
+	}
+	return SerializerJSON
+}
+
+// looksLikeMsgpackMap reports whether data starts with a msgpack map marker
+func looksLikeMsgpackMap(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	marker := data[0]
+	return marker&0xf0 == 0x80 || marker == 0xde || marker == 0xdf
+}
+
+// decodeMsgpack decodes a msgpack-serialized reply body
+func decodeMsgpack(data []byte) (map[string]interface{}, error) {
+	var decoded map[string]interface{}
+	if err := msgpack.Unmarshal(data, &decoded); err != nil {
+		return nil, fmt.Errorf("failed to parse msgpack body: %w", err)
+	}
+	return decoded, nil
 }
 
 // ExtractWorkerName extracts worker name from various response formats
@@ -211,10 +517,42 @@ func (h *Handler) ValidateResponse(response map[string]interface{}) bool {
 	return false
 }
 
+// ClassifyReply strictly validates a parsed response and returns its typed
+// form. Only replies keyed by a worker name (containing "@") whose value
+// holds an "ok" or "error" string are recognized; everything else is
+// ReplyUnknown.
+func (h *Handler) ClassifyReply(response map[string]interface{}) WorkerReply {
+	for workerName, value := range response {
+		if !strings.Contains(workerName, "@") {
+			continue
+		}
+
+		workerData, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if status, exists := workerData["ok"]; exists {
+			if statusStr, ok := status.(string); ok {
+				return WorkerReply{WorkerName: workerName, Status: ReplyOK, OK: statusStr, Meta: replyMeta(workerData)}
+			}
+		}
+
+		if errValue, exists := workerData["error"]; exists {
+			return WorkerReply{WorkerName: workerName, Status: ReplyError, Error: fmt.Sprint(errValue), Meta: replyMeta(workerData)}
+		}
+	}
+
+	return WorkerReply{WorkerName: h.ExtractWorkerName(response), Status: ReplyUnknown}
+}
+
 // CreateReplyQueue generates a unique reply queue name
 func (h *Handler) CreateReplyQueue() string {
+	if h.replyQueuePrefix != "" {
+		return fmt.Sprintf("%s.%s.%d.%s", h.replyQueuePrefix, generateHostname(), os.Getpid(), newID()[:8])
+	}
 	// Use simple UUID format like Python Celery does
-	return uuid.New().String()
+	return newID()
 }
 
 // GetBroadcastQueue returns the broadcast queue name for ping messages
@@ -222,11 +560,87 @@ func (h *Handler) GetBroadcastQueue() string {
 	return "celeryctl-broadcast-pidbox"
 }
 
-// generateHostname creates a hostname for this instance
+// osHostname looks up the machine hostname; tests replace it
+var osHostname = os.Hostname
+
+// generateHostname returns the machine hostname so workers can tell where a
+// control message came from, falling back to a random identifier
 func generateHostname() string {
-	// In a real implementation, you might want to get the actual hostname
-	// For now, use a UUID-based identifier
-	return fmt.Sprintf("host-%s", uuid.New().String()[:8])
+	hostname, err := osHostname()
+	if err != nil || hostname == "" {
+		return fmt.Sprintf("host-%s", newID()[:8])
+	}
+	return hostname
+}
+
+// MatchesTicket reports whether a reply belongs to the control message sent
+// with ticket. response is either a reply envelope (ticket under "headers")
+// or a message's headers table. Replies that carry no ticket are accepted,
+// since not every sender echoes one.
+func (h *Handler) MatchesTicket(response map[string]interface{}, ticket string) bool {
+	return h.MatchesAnyTicket(response, ticket)
+}
+
+// MatchesAnyTicket is MatchesTicket for a command sent as several messages,
+// each with its own ticket
+func (h *Handler) MatchesAnyTicket(response map[string]interface{}, tickets ...string) bool {
+	if headers, ok := response["headers"].(map[string]interface{}); ok {
+		response = headers
+	}
+
+	replyTicket, _ := response["ticket"].(string)
+	if replyTicket == "" {
+		return true
+	}
+	for _, ticket := range tickets {
+		if replyTicket == ticket {
+			return true
+		}
+	}
+	return false
+}
+
+// ReplyMatchesAnyTicket is MatchesAnyTicket for a raw reply envelope. Only
+// the ticket is decoded, and a reply that never mentions one is accepted
+// without decoding anything; data that is not a JSON object is accepted too.
+func (h *Handler) ReplyMatchesAnyTicket(data []byte, tickets ...string) bool {
+	if !bytes.Contains(data, ticketKey) {
+		return true
+	}
+
+	var envelope rawEnvelope
+	if json.Unmarshal(data, &envelope) != nil {
+		return true
+	}
+	if headers := envelope.object("headers"); headers != nil {
+		envelope = headers
+	}
+
+	replyTicket := envelope.str("ticket")
+	if replyTicket == "" {
+		return true
+	}
+	for _, ticket := range tickets {
+		if replyTicket == ticket {
+			return true
+		}
+	}
+	return false
+}
+
+// replyMeta returns the reply fields other than ok/error, or nil if none
+func replyMeta(workerData map[string]interface{}) map[string]interface{} {
+	var meta map[string]interface{}
+	for key, value := range workerData {
+		if key == "ok" || key == "error" {
+			continue
+		}
+		if meta == nil {
+			meta = make(map[string]interface{})
+		}
+		meta[key] = value
+	}
+	return meta
 }
 
 // FormatResponse formats the response in the expected Celery format
@@ -1,9 +1,18 @@
 package protocol
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
 )
 
 func TestHandler_NewHandler(t *testing.T) {
@@ -18,6 +27,89 @@ func TestHandler_NewHandler(t *testing.T) {
 	}
 }
 
+func TestGenerateHostname(t *testing.T) {
+	original := osHostname
+	defer func() { osHostname = original }()
+
+	tests := []struct {
+		name     string
+		lookup   func() (string, error)
+		expected func(string) bool
+	}{
+		{
+			name:   "real hostname",
+			lookup: func() (string, error) { return "celery-probe-1", nil },
+			expected: func(hostname string) bool {
+				return hostname == "celery-probe-1"
+			},
+		},
+		{
+			name:   "lookup error falls back to random id",
+			lookup: func() (string, error) { return "", errors.New("no hostname") },
+			expected: func(hostname string) bool {
+				return strings.HasPrefix(hostname, "host-") && len(hostname) == len("host-")+8
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			osHostname = tt.lookup
+
+			if hostname := generateHostname(); !tt.expected(hostname) {
+				t.Errorf("Unexpected hostname %q", hostname)
+			}
+		})
+	}
+}
+
+func TestHandler_NewHandler_NodeID(t *testing.T) {
+	original := osHostname
+	defer func() { osHostname = original }()
+	osHostname = func() (string, error) { return "celery-probe-1", nil }
+
+	handler := NewHandler()
+	if handler.nodeID != "fast-celery-ping@celery-probe-1" {
+		t.Errorf("Expected nodeID fast-celery-ping@celery-probe-1, got %s", handler.nodeID)
+	}
+}
+
+func TestHandler_ControlMessageOrigin(t *testing.T) {
+	original := osHostname
+	defer func() { osHostname = original }()
+	osHostname = func() (string, error) { return "celery-probe-1", nil }
+
+	tests := []struct {
+		name     string
+		handler  *Handler
+		format   MessageFormat
+		expected string
+	}{
+		{name: "default raw", handler: NewHandler(), format: MessageFormatRaw, expected: "fast-celery-ping@celery-probe-1"},
+		{name: "empty id keeps default", handler: NewHandlerWithID(""), format: MessageFormatRaw, expected: "fast-celery-ping@celery-probe-1"},
+		{name: "override raw", handler: NewHandlerWithID("deploy-check@ci"), format: MessageFormatRaw, expected: "deploy-check@ci"},
+		{name: "override enveloped", handler: NewHandlerWithID("deploy-check@ci"), format: MessageFormatEnveloped, expected: "deploy-check@ci"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _, err := tt.handler.CreatePingMessage("reply-queue", nil, 0, tt.format)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			// ParseWorkerResponse unwraps the envelope, if any
+			message, err := tt.handler.ParseWorkerResponse(data)
+			if err != nil {
+				t.Fatalf("Failed to parse message: %v", err)
+			}
+			if message["origin"] != tt.expected {
+				t.Errorf("Expected origin %q, got %v", tt.expected, message["origin"])
+			}
+		})
+	}
+}
+
 func TestHandler_CreateReplyQueue(t *testing.T) {
 	handler := NewHandler()
 
@@ -33,6 +125,26 @@ func TestHandler_CreateReplyQueue(t *testing.T) {
 	}
 }
 
+func TestHandler_CreateReplyQueue_Prefix(t *testing.T) {
+	original := osHostname
+	defer func() { osHostname = original }()
+	osHostname = func() (string, error) { return "celery-probe-1", nil }
+
+	handler := NewHandler()
+	handler.SetReplyQueuePrefix("fast-celery-ping")
+
+	queue1 := handler.CreateReplyQueue()
+	queue2 := handler.CreateReplyQueue()
+
+	prefix := fmt.Sprintf("fast-celery-ping.celery-probe-1.%d.", os.Getpid())
+	if !strings.HasPrefix(queue1, prefix) || len(queue1) != len(prefix)+8 {
+		t.Errorf("Expected %s<8 random characters>, got %q", prefix, queue1)
+	}
+	if queue1 == queue2 {
+		t.Error("Expected different queue names for each call")
+	}
+}
+
 func TestHandler_GetBroadcastQueue(t *testing.T) {
 	handler := NewHandler()
 
@@ -82,10 +194,13 @@ func TestHandler_CreatePingMessage(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			messageData, err := handler.CreatePingMessage(replyTo, tt.destinations, tt.format)
+			messageData, ticket, err := handler.CreatePingMessage(replyTo, tt.destinations, 0, tt.format)
 			if err != nil {
 				t.Fatalf("Failed to create ping message: %v", err)
 			}
+			if ticket == "" {
+				t.Error("Expected the generated ticket to be returned")
+			}
 
 			var message map[string]interface{}
 			err = json.Unmarshal(messageData, &message)
@@ -153,6 +268,46 @@ func TestHandler_ExtractWorkerName(t *testing.T) {
 	}
 }
 
+func TestHandler_NonASCIIWorkerNames(t *testing.T) {
+	handler := NewHandler()
+	const worker = "célery@hôst-工作者🚀"
+
+	encode := func(body []byte) []byte {
+		return []byte(`{"body": "` + base64.StdEncoding.EncodeToString(body) + `", "content-type": "application/json", "properties": {"body_encoding": "base64"}}`)
+	}
+	msgpackBody, err := msgpack.Marshal(map[string]interface{}{worker: map[string]interface{}{"ok": "pong"}})
+	if err != nil {
+		t.Fatalf("Failed to encode msgpack body: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "raw UTF-8 body", data: encode([]byte(`{"` + worker + `": {"ok": "pong"}}`))},
+		// Python's json.dumps escapes non-ASCII characters by default,
+		// including the surrogate pair for the emoji
+		{name: "escaped body", data: encode([]byte(`{"c\u00e9lery@h\u00f4st-\u5de5\u4f5c\u8005\ud83d\ude80": {"ok": "pong"}}`))},
+		{name: "unenveloped reply", data: []byte(`{"` + worker + `": {"ok": "pong"}}`)},
+		{name: "msgpack body", data: []byte(`{"body": "` + base64.StdEncoding.EncodeToString(msgpackBody) + `", "content-type": "application/x-msgpack"}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := handler.ParseWorkerResponse(tt.data)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if name := handler.ExtractWorkerName(parsed); name != worker {
+				t.Errorf("Expected worker %q, got %q", worker, name)
+			}
+			if !handler.ValidateResponse(parsed) {
+				t.Errorf("Expected a valid ping response from %q", worker)
+			}
+		})
+	}
+}
+
 func TestHandler_ValidateResponse(t *testing.T) {
 	handler := NewHandler()
 
@@ -203,6 +358,89 @@ func TestHandler_ValidateResponse(t *testing.T) {
 	}
 }
 
+func TestHandler_ClassifyReply(t *testing.T) {
+	handler := NewHandler()
+
+	tests := []struct {
+		name     string
+		response map[string]interface{}
+		expected WorkerReply
+	}{
+		{
+			name: "pong reply",
+			response: map[string]interface{}{
+				"celery@nero": map[string]interface{}{
+					"ok": "pong",
+				},
+			},
+			expected: WorkerReply{WorkerName: "celery@nero", Status: ReplyOK, OK: "pong"},
+		},
+		{
+			name: "pong reply with metadata",
+			response: map[string]interface{}{
+				"celery@nero": map[string]interface{}{
+					"ok":     "pong",
+					"sw_ver": "5.4.0",
+					"pool":   "prefork",
+				},
+			},
+			expected: WorkerReply{
+				WorkerName: "celery@nero",
+				Status:     ReplyOK,
+				OK:         "pong",
+				Meta:       map[string]interface{}{"sw_ver": "5.4.0", "pool": "prefork"},
+			},
+		},
+		{
+			name: "error reply",
+			response: map[string]interface{}{
+				"celery@nero": map[string]interface{}{
+					"error": "No such command",
+				},
+			},
+			expected: WorkerReply{WorkerName: "celery@nero", Status: ReplyError, Error: "No such command"},
+		},
+		{
+			name: "hostname-only reply is unknown",
+			response: map[string]interface{}{
+				"hostname": "worker@host",
+			},
+			expected: WorkerReply{WorkerName: "worker@host", Status: ReplyUnknown},
+		},
+		{
+			name: "worker key without ok or error is unknown",
+			response: map[string]interface{}{
+				"celery@nero": map[string]interface{}{
+					"something": "else",
+				},
+			},
+			expected: WorkerReply{Status: ReplyUnknown},
+		},
+		{
+			name: "top-level error without worker is unknown",
+			response: map[string]interface{}{
+				"error": "boom",
+			},
+			expected: WorkerReply{Status: ReplyUnknown},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := handler.ClassifyReply(tt.response)
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestReplyStatus_String(t *testing.T) {
+	if ReplyOK.String() != "ok" || ReplyError.String() != "error" || ReplyUnknown.String() != "unknown" {
+		t.Errorf("Unexpected reply status names: %s, %s, %s", ReplyOK, ReplyError, ReplyUnknown)
+	}
+}
+
 func TestHandler_ParseWorkerResponse(t *testing.T) {
 	handler := NewHandler()
 
@@ -310,6 +548,228 @@ func TestHandler_ParseWorkerResponse(t *testing.T) {
 	}
 }
 
+func TestHandler_ParseWorkerResponse_EnvelopeEdgeCases(t *testing.T) {
+	handler := NewHandler()
+	// "???" encodes to base64 with a slash, which some encoders escape
+	slashBody := base64.StdEncoding.EncodeToString([]byte(`{"celery@host": {"ok": "???"}}`))
+	if !strings.Contains(slashBody, "/") {
+		t.Fatalf("Expected a base64 body with a slash, got %s", slashBody)
+	}
+
+	tests := []struct {
+		name     string
+		data     string
+		expected map[string]interface{}
+	}{
+		{
+			name:     "escaped base64 body",
+			data:     `{"body": "` + strings.ReplaceAll(slashBody, "/", `\/`) + `", "properties": {"body_encoding": "base64"}}`,
+			expected: map[string]interface{}{"celery@host": map[string]interface{}{"ok": "???"}},
+		},
+		{
+			name:     "null body returns the envelope",
+			data:     `{"body": null, "hostname": "worker@host"}`,
+			expected: map[string]interface{}{"body": nil, "hostname": "worker@host"},
+		},
+		{
+			name:     "non-string headers are ignored",
+			data:     `{"body": "eyJjZWxlcnlAaG9zdCI6IHsib2siOiAicG9uZyJ9fQ==", "headers": [1], "content-type": 5}`,
+			expected: map[string]interface{}{"celery@host": map[string]interface{}{"ok": "pong"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := handler.ParseWorkerResponse([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(parsed, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, parsed)
+			}
+		})
+	}
+}
+
+func TestHandler_ParseWorkerResponse_ArrayBody(t *testing.T) {
+	handler := NewHandler()
+	arrayBody := `[{"w1@host": {"ok": "pong"}}, {"w2@host": {"ok": "pong"}}]`
+	both := map[string]interface{}{
+		"w1@host": map[string]interface{}{"ok": "pong"},
+		"w2@host": map[string]interface{}{"ok": "pong"},
+	}
+
+	tests := []struct {
+		name     string
+		data     string
+		expected map[string]interface{}
+		wantErr  bool
+	}{
+		{
+			name:     "base64 array body",
+			data:     `{"body": "` + base64.StdEncoding.EncodeToString([]byte(arrayBody)) + `", "properties": {"body_encoding": "base64"}}`,
+			expected: both,
+		},
+		{
+			name:     "raw array body",
+			data:     `{"body": ` + strconv.Quote(arrayBody) + `, "content-type": "application/json", "properties": {}}`,
+			expected: both,
+		},
+		{
+			name:     "bare array",
+			data:     arrayBody,
+			expected: both,
+		},
+		{
+			name:     "bare array with a body key",
+			data:     `[{"body": "eyJ9"}, {"w1@host": {"ok": "pong"}}]`,
+			expected: map[string]interface{}{"body": "eyJ9", "w1@host": map[string]interface{}{"ok": "pong"}},
+		},
+		{
+			name:     "later elements win",
+			data:     `[{"w1@host": {"ok": "pong"}}, {"w1@host": {"error": "busy"}}]`,
+			expected: map[string]interface{}{"w1@host": map[string]interface{}{"error": "busy"}},
+		},
+		{
+			name:     "empty array",
+			data:     `[]`,
+			expected: map[string]interface{}{},
+		},
+		{
+			name:    "array of strings",
+			data:    `["pong"]`,
+			wantErr: true,
+		},
+		{
+			name:    "base64 array of strings",
+			data:    `{"body": "` + base64.StdEncoding.EncodeToString([]byte(`["pong"]`)) + `", "properties": {"body_encoding": "base64"}}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := handler.ParseWorkerResponse([]byte(tt.data))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got %v", parsed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(parsed, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, parsed)
+			}
+		})
+	}
+
+	parsed, err := handler.ParseWorkerResponse([]byte(`[{"w1@host": {"ok": "pong"}}]`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !handler.ValidateResponse(parsed) || handler.ExtractWorkerName(parsed) != "w1@host" {
+		t.Errorf("Expected a valid pong from w1@host, got %v", parsed)
+	}
+}
+
+func TestHandler_ParseWorkerResponse_DoesNotRetainBuffers(t *testing.T) {
+	handler := NewHandler()
+	reply := func(payload []byte) []byte {
+		body, err := msgpack.Marshal(map[string]interface{}{"celery@host": map[string]interface{}{"ok": payload}})
+		if err != nil {
+			t.Fatalf("Failed to encode msgpack body: %v", err)
+		}
+		return []byte(`{"body": "` + base64.StdEncoding.EncodeToString(body) + `", "content-type": "application/x-msgpack"}`)
+	}
+
+	first, err := handler.ParseWorkerResponse(reply([]byte("first-payload")))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := handler.ParseWorkerResponse(reply([]byte("other-payload"))); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	ok := first["celery@host"].(map[string]interface{})["ok"]
+	if got, _ := ok.([]byte); string(got) != "first-payload" {
+		t.Errorf("Expected the first reply to keep its payload, got %q", ok)
+	}
+}
+
+// benchmarkReplies are typical worker replies: a kombu Redis envelope and
+// the bare body AMQP delivers
+func benchmarkReplies(b *testing.B) map[string][]byte {
+	body := []byte(`{"celery@worker-42.example.com": {"ok": "pong"}}`)
+	envelope := func(body, contentType string) []byte {
+		data, err := json.Marshal(map[string]interface{}{
+			"body":             body,
+			"content-encoding": "utf-8",
+			"content-type":     contentType,
+			"headers":          map[string]interface{}{"clock": 7, "expires": 1700000000.5},
+			"properties": map[string]interface{}{
+				"correlation_id": "b0c5a1c6-0bb8-4b5e-9d8f-0f4e3c2a1b00",
+				"reply_to":       "5d9f0c3e-7a51-3c8e-a2b4-6e1f9d0c8b7a",
+				"delivery_mode":  2,
+				"delivery_info":  map[string]interface{}{"exchange": "reply.celery.pidbox", "routing_key": "5d9f0c3e"},
+				"priority":       0,
+				"body_encoding":  "base64",
+				"delivery_tag":   "0d6a7b8c-9e0f-4a1b-8c2d-3e4f5a6b7c8d",
+			},
+		})
+		if err != nil {
+			b.Fatalf("Failed to build envelope: %v", err)
+		}
+		return data
+	}
+
+	msgpackBody, err := msgpack.Marshal(map[string]interface{}{"celery@worker-42.example.com": map[string]interface{}{"ok": "pong"}})
+	if err != nil {
+		b.Fatalf("Failed to encode msgpack body: %v", err)
+	}
+
+	return map[string][]byte{
+		"redis_json":    envelope(base64.StdEncoding.EncodeToString(body), JSONContentType),
+		"redis_msgpack": envelope(base64.StdEncoding.EncodeToString(msgpackBody), MsgpackContentType),
+		"amqp_json":     body,
+	}
+}
+
+func BenchmarkParseWorkerResponse(b *testing.B) {
+	replies := benchmarkReplies(b)
+	for _, name := range []string{"redis_json", "redis_msgpack", "amqp_json"} {
+		data := replies[name]
+		b.Run(name, func(b *testing.B) {
+			handler := NewHandler()
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if _, err := handler.ParseWorkerResponse(data); err != nil {
+					b.Fatalf("Unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkParseWorkerResponse_Parallel(b *testing.B) {
+	data := benchmarkReplies(b)["redis_json"]
+	handler := NewHandler()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := handler.ParseWorkerResponse(data); err != nil {
+				b.Errorf("Unexpected error: %v", err)
+				return
+			}
+		}
+	})
+}
+
 func TestHandler_FormatResponse(t *testing.T) {
 	handler := NewHandler()
 
@@ -375,7 +835,7 @@ func TestHandler_CreatePingMessageRaw(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			data, err := handler.CreatePingMessage(tt.replyTo, tt.destinations, MessageFormatRaw)
+			data, _, err := handler.CreatePingMessage(tt.replyTo, tt.destinations, 0, MessageFormatRaw)
 			if err != nil {
 				t.Fatalf("CreatePingMessage() error = %v", err)
 			}
@@ -459,3 +919,487 @@ func TestHandler_CreatePingMessageRaw(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_CreateControlMessage(t *testing.T) {
+	handler := NewHandler()
+
+	data, ticket, err := handler.CreateControlMessage("stats", nil, "reply-queue", []string{"worker1@host"}, 0, MessageFormatRaw)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var message map[string]interface{}
+	if err := json.Unmarshal(data, &message); err != nil {
+		t.Fatalf("Failed to parse control message: %v", err)
+	}
+
+	if message["method"] != "stats" {
+		t.Errorf("Expected method stats, got %v", message["method"])
+	}
+
+	if arguments, ok := message["arguments"].(map[string]interface{}); !ok || len(arguments) != 0 {
+		t.Errorf("Expected empty arguments object, got %v", message["arguments"])
+	}
+
+	destinations, ok := message["destination"].([]interface{})
+	if !ok || len(destinations) != 1 || destinations[0] != "worker1@host" {
+		t.Errorf("Expected destination [worker1@host], got %v", message["destination"])
+	}
+
+	if ticket == "" || message["ticket"] != ticket {
+		t.Errorf("Expected returned ticket %q to match message ticket %v", ticket, message["ticket"])
+	}
+}
+
+func TestHandler_CreatePingMessage_Expires(t *testing.T) {
+	handler := NewHandler()
+
+	tests := []struct {
+		name     string
+		expires  time.Duration
+		expected time.Duration
+	}{
+		{name: "default window", expires: 0, expected: DefaultMessageExpiry},
+		{name: "short window", expires: 2 * time.Second, expected: 2 * time.Second},
+		{name: "long window", expires: 31 * time.Second, expected: 31 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := time.Now()
+			data, _, err := handler.CreatePingMessage("reply-queue", nil, tt.expires, MessageFormatEnveloped)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var envelope struct {
+				Headers struct {
+					Expires float64 `json:"expires"`
+				} `json:"headers"`
+			}
+			if err := json.Unmarshal(data, &envelope); err != nil {
+				t.Fatalf("Failed to parse envelope: %v", err)
+			}
+
+			// The header keeps sub-second precision
+			earliest := unixSeconds(before.Add(tt.expected))
+			latest := unixSeconds(time.Now().Add(tt.expected))
+			if envelope.Headers.Expires < earliest || envelope.Headers.Expires > latest {
+				t.Errorf("Expected expires between %f and %f, got %f", earliest, latest, envelope.Headers.Expires)
+			}
+		})
+	}
+}
+
+func TestHandler_MatchesTicket(t *testing.T) {
+	handler := NewHandler()
+
+	tests := []struct {
+		name     string
+		response map[string]interface{}
+		expected bool
+	}{
+		{
+			name:     "envelope echoing our ticket",
+			response: map[string]interface{}{"headers": map[string]interface{}{"ticket": "abc-123", "clock": 7}},
+			expected: true,
+		},
+		{
+			name:     "envelope answering another ticket",
+			response: map[string]interface{}{"headers": map[string]interface{}{"ticket": "old-run"}},
+			expected: false,
+		},
+		{
+			name:     "headers table echoing our ticket",
+			response: map[string]interface{}{"ticket": "abc-123"},
+			expected: true,
+		},
+		{
+			name:     "headers table answering another ticket",
+			response: map[string]interface{}{"ticket": "old-run"},
+			expected: false,
+		},
+		{
+			name:     "reply without ticket",
+			response: map[string]interface{}{"celery@host": map[string]interface{}{"ok": "pong"}},
+			expected: true,
+		},
+		{
+			name:     "nil headers",
+			response: nil,
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := handler.MatchesTicket(tt.response, "abc-123"); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestHandler_ReplyMatchesAnyTicket(t *testing.T) {
+	handler := NewHandler()
+
+	tests := []struct {
+		name     string
+		data     string
+		expected bool
+	}{
+		{
+			name:     "envelope echoing the first ticket",
+			data:     `{"body": "e30=", "headers": {"ticket": "abc-123", "clock": 7}}`,
+			expected: true,
+		},
+		{
+			name:     "envelope echoing the second ticket",
+			data:     `{"body": "e30=", "headers": {"ticket": "def-456"}}`,
+			expected: true,
+		},
+		{
+			name:     "envelope answering another ticket",
+			data:     `{"body": "e30=", "headers": {"ticket": "old-run"}}`,
+			expected: false,
+		},
+		{
+			name:     "top-level ticket when headers are null",
+			data:     `{"headers": null, "ticket": "old-run"}`,
+			expected: false,
+		},
+		{
+			name:     "headers without ticket",
+			data:     `{"body": "e30=", "headers": {"clock": 7}, "ticket": "old-run"}`,
+			expected: true,
+		},
+		{
+			name:     "reply without ticket",
+			data:     `{"celery@host": {"ok": "pong"}}`,
+			expected: true,
+		},
+		{
+			name:     "non-string ticket",
+			data:     `{"headers": {"ticket": 42}}`,
+			expected: true,
+		},
+		{
+			name:     "not a JSON object",
+			data:     `["ticket"]`,
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := handler.ReplyMatchesAnyTicket([]byte(tt.data), "abc-123", "def-456"); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestHandler_ParseWorkerResponse_Msgpack(t *testing.T) {
+	body, err := msgpack.Marshal(map[string]interface{}{
+		"celery@nero": map[string]interface{}{"ok": "pong"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode msgpack body: %v", err)
+	}
+
+	enveloped := func(contentType string) []byte {
+		data, _ := json.Marshal(map[string]interface{}{
+			"body":         base64.StdEncoding.EncodeToString(body),
+			"content-type": contentType,
+		})
+		return data
+	}
+
+	tests := []struct {
+		name       string
+		serializer string
+		data       []byte
+		wantErr    bool
+	}{
+		{
+			name: "enveloped msgpack detected from content-type",
+			data: enveloped("application/x-msgpack"),
+		},
+		{
+			name:       "enveloped msgpack forced by serializer",
+			serializer: SerializerMsgpack,
+			data:       enveloped("application/json"),
+		},
+		{
+			name:       "forced json rejects msgpack body",
+			serializer: SerializerJSON,
+			data:       enveloped("application/x-msgpack"),
+			wantErr:    true,
+		},
+		{
+			name: "raw msgpack detected without envelope",
+			data: body,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHandler()
+			if err := handler.SetSerializer(tt.serializer); err != nil {
+				t.Fatalf("Unexpected error setting serializer: %v", err)
+			}
+
+			result, err := handler.ParseWorkerResponse(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			reply := handler.ClassifyReply(result)
+			if reply.Status != ReplyOK || reply.WorkerName != "celery@nero" || reply.OK != "pong" {
+				t.Errorf("Expected pong from celery@nero, got %+v", reply)
+			}
+		})
+	}
+}
+
+func TestHandler_SetSerializer(t *testing.T) {
+	handler := NewHandler()
+
+	for _, serializer := range []string{"", SerializerAuto, SerializerJSON, SerializerMsgpack} {
+		if err := handler.SetSerializer(serializer); err != nil {
+			t.Errorf("Expected serializer %q to be accepted, got: %v", serializer, err)
+		}
+	}
+
+	if err := handler.SetSerializer("pickle"); err == nil {
+		t.Error("Expected unsupported serializer to be rejected")
+	}
+}
+
+func TestHandler_SetMessageEncoding(t *testing.T) {
+	tests := []struct {
+		name         string
+		contentType  string
+		bodyEncoding string
+		format       MessageFormat
+		// decode returns the serialized control message from the body
+		decode func(t *testing.T, body interface{}, properties map[string]interface{}) []byte
+		// unmarshal parses the serialized control message
+		unmarshal func([]byte, interface{}) error
+		wantType  string
+	}{
+		{
+			name:   "json in base64 by default",
+			format: MessageFormatEnveloped,
+			decode: func(t *testing.T, body interface{}, properties map[string]interface{}) []byte {
+				if properties["body_encoding"] != BodyEncodingBase64 {
+					t.Errorf("Expected body_encoding base64, got %v", properties["body_encoding"])
+				}
+				data, err := base64.StdEncoding.DecodeString(body.(string))
+				if err != nil {
+					t.Fatalf("Expected a base64 body: %v", err)
+				}
+				return data
+			},
+			unmarshal: json.Unmarshal,
+			wantType:  JSONContentType,
+		},
+		{
+			name:         "raw json",
+			contentType:  JSONContentType,
+			bodyEncoding: BodyEncodingNone,
+			format:       MessageFormatEnveloped,
+			decode: func(t *testing.T, body interface{}, properties map[string]interface{}) []byte {
+				if _, exists := properties["body_encoding"]; exists {
+					t.Errorf("Expected no body_encoding for a raw body, got %v", properties["body_encoding"])
+				}
+				return []byte(body.(string))
+			},
+			unmarshal: json.Unmarshal,
+			wantType:  JSONContentType,
+		},
+		{
+			name:         "msgpack in base64",
+			contentType:  MsgpackContentType,
+			bodyEncoding: BodyEncodingBase64,
+			format:       MessageFormatEnveloped,
+			decode: func(t *testing.T, body interface{}, properties map[string]interface{}) []byte {
+				data, err := base64.StdEncoding.DecodeString(body.(string))
+				if err != nil {
+					t.Fatalf("Expected a base64 body: %v", err)
+				}
+				return data
+			},
+			unmarshal: msgpack.Unmarshal,
+			wantType:  MsgpackContentType,
+		},
+		{
+			name:        "raw format msgpack",
+			contentType: MsgpackContentType,
+			format:      MessageFormatRaw,
+			unmarshal:   msgpack.Unmarshal,
+			wantType:    MsgpackContentType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHandler()
+			if err := handler.SetMessageEncoding(tt.contentType, tt.bodyEncoding); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if handler.ContentType() != tt.wantType {
+				t.Errorf("Expected content type %s, got %s", tt.wantType, handler.ContentType())
+			}
+
+			data, ticket, err := handler.CreateControlMessage("ping", nil, "reply-queue", nil, 0, tt.format)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			body := data
+			if tt.format == MessageFormatEnveloped {
+				var envelope map[string]interface{}
+				if err := json.Unmarshal(data, &envelope); err != nil {
+					t.Fatalf("Failed to parse envelope: %v", err)
+				}
+				if envelope["content-type"] != tt.wantType {
+					t.Errorf("Expected envelope content-type %s, got %v", tt.wantType, envelope["content-type"])
+				}
+				properties, _ := envelope["properties"].(map[string]interface{})
+				body = tt.decode(t, envelope["body"], properties)
+			}
+
+			var message map[string]interface{}
+			if err := tt.unmarshal(body, &message); err != nil {
+				t.Fatalf("Failed to parse control message: %v", err)
+			}
+			if message["method"] != "ping" || message["ticket"] != ticket {
+				t.Errorf("Expected ping with ticket %s, got %v", ticket, message)
+			}
+		})
+	}
+}
+
+func TestHandler_SetMessageEncoding_Invalid(t *testing.T) {
+	tests := []struct {
+		contentType  string
+		bodyEncoding string
+		wantErr      string
+	}{
+		{contentType: "application/x-yaml", wantErr: "unsupported content type: application/x-yaml (supported: application/json, application/x-msgpack)"},
+		{bodyEncoding: "hex", wantErr: "unsupported body encoding: hex (supported: base64, none)"},
+		{contentType: MsgpackContentType, bodyEncoding: BodyEncodingNone, wantErr: "msgpack bodies require base64 body encoding"},
+	}
+
+	for _, tt := range tests {
+		handler := NewHandler()
+		err := handler.SetMessageEncoding(tt.contentType, tt.bodyEncoding)
+		if err == nil || err.Error() != tt.wantErr {
+			t.Errorf("Expected error %q, got %v", tt.wantErr, err)
+		}
+		if handler.ContentType() != JSONContentType {
+			t.Errorf("Expected a rejected encoding to keep %s, got %s", JSONContentType, handler.ContentType())
+		}
+	}
+}
+
+func TestHandler_ParseWorkerResponse_RawBody(t *testing.T) {
+	handler := NewHandler()
+	envelope := `{"body": "{\"worker1@host\": {\"ok\": \"pong\"}}", "content-type": "application/json", "properties": {}}`
+
+	parsed, err := handler.ParseWorkerResponse([]byte(envelope))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	reply, ok := parsed["worker1@host"].(map[string]interface{})
+	if !ok || reply["ok"] != "pong" {
+		t.Errorf("Expected pong from worker1@host, got %v", parsed)
+	}
+
+	encoded := `{"body": "not base64!", "properties": {"body_encoding": "base64"}}`
+	if _, err := handler.ParseWorkerResponse([]byte(encoded)); err == nil {
+		t.Error("Expected a base64 error when body_encoding is set")
+	}
+}
+
+func TestHandler_SetPattern(t *testing.T) {
+	tests := []struct {
+		name        string
+		pattern     string
+		matcher     string
+		wantErr     bool
+		wantPattern interface{}
+		wantMatcher interface{}
+	}{
+		{
+			name:        "no pattern",
+			wantPattern: nil,
+			wantMatcher: nil,
+		},
+		{
+			name:        "glob pattern",
+			pattern:     "gpu-*",
+			matcher:     "glob",
+			wantPattern: "gpu-*",
+			wantMatcher: "glob",
+		},
+		{
+			name:        "pattern without matcher",
+			pattern:     "gpu-*",
+			wantPattern: "gpu-*",
+			wantMatcher: nil,
+		},
+		{
+			name:    "matcher without pattern",
+			matcher: "pcre",
+			wantErr: true,
+		},
+		{
+			name:    "unsupported matcher",
+			pattern: "gpu-*",
+			matcher: "regex",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHandler()
+
+			err := handler.SetPattern(tt.pattern, tt.matcher)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			data, _, err := handler.CreatePingMessage("reply-queue", nil, 0, MessageFormatRaw)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var message map[string]interface{}
+			if err := json.Unmarshal(data, &message); err != nil {
+				t.Fatalf("Failed to parse message: %v", err)
+			}
+
+			if message["pattern"] != tt.wantPattern {
+				t.Errorf("Expected pattern %v, got %v", tt.wantPattern, message["pattern"])
+			}
+			if message["matcher"] != tt.wantMatcher {
+				t.Errorf("Expected matcher %v, got %v", tt.wantMatcher, message["matcher"])
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package protocol
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// newRandomUUID generates the random UUIDs behind newID; tests replace it
+var newRandomUUID = uuid.NewRandom
+
+// fallbackIDs counts the IDs newID had to derive without randomness
+var fallbackIDs atomic.Uint64
+
+// newID returns a random UUID string for tickets, delivery tags and reply
+// queues. Should the system's random source fail (uuid.New would panic),
+// it derives a name-based UUID from the time, pid and a counter instead:
+// unique within the process and still random-looking in every prefix.
+func newID() string {
+	id, err := newRandomUUID()
+	if err == nil {
+		return id.String()
+	}
+	name := fmt.Sprintf("%d.%d.%d", time.Now().UnixNano(), os.Getpid(), fallbackIDs.Add(1))
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(name)).String()
+}
@@ -0,0 +1,64 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestNewID(t *testing.T) {
+	id := newID()
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		t.Fatalf("Expected a UUID, got %q: %v", id, err)
+	}
+	if parsed.Version() != 4 {
+		t.Errorf("Expected a random (v4) UUID, got version %d", parsed.Version())
+	}
+}
+
+func TestNewID_RandomSourceFails(t *testing.T) {
+	original := newRandomUUID
+	defer func() { newRandomUUID = original }()
+	newRandomUUID = func() (uuid.UUID, error) {
+		return uuid.Nil, errors.New("entropy source unavailable")
+	}
+
+	seen := make(map[string]bool)
+	prefixes := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		id := newID()
+		if _, err := uuid.Parse(id); err != nil {
+			t.Fatalf("Expected a UUID, got %q: %v", id, err)
+		}
+		if seen[id] {
+			t.Fatalf("Expected unique IDs, got %q twice", id)
+		}
+		seen[id] = true
+		// Prefixed reply queues use the first 8 characters
+		prefixes[id[:8]] = true
+	}
+	if len(prefixes) < 990 {
+		t.Errorf("Expected random-looking prefixes, got %d distinct of 1000", len(prefixes))
+	}
+
+	// Everything that needs an ID keeps working
+	handler := NewHandler()
+	handler.SetReplyQueuePrefix("celeryping")
+	if queue := handler.CreateReplyQueue(); !strings.HasPrefix(queue, "celeryping.") {
+		t.Errorf("Expected a prefixed reply queue, got %q", queue)
+	}
+	data, ticket, err := handler.CreateControlMessage("ping", nil, "reply", nil, 0, MessageFormatEnveloped)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := uuid.Parse(ticket); err != nil {
+		t.Errorf("Expected a UUID ticket, got %q", ticket)
+	}
+	if !json.Valid(data) {
+		t.Errorf("Expected a valid envelope, got %s", data)
+	}
+}
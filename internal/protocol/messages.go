@@ -2,6 +2,7 @@ package protocol
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -44,6 +45,94 @@ type PingResponse struct {
 	Ticket    string                 `json:"ticket,omitempty"`
 }
 
+// ReplyTimestamp returns the worker-reported time of a reply, taken from a
+// top-level "timestamp" (the PingResponse shape) or from one inside the
+// worker's own entry. ok is false when the reply carries no timestamp.
+func ReplyTimestamp(response map[string]interface{}, workerName string) (time.Time, bool) {
+	entry, _ := response[workerName].(map[string]interface{})
+	for _, fields := range []map[string]interface{}{response, entry} {
+		if timestamp, ok := unixTimestamp(fields["timestamp"]); ok && timestamp > 0 {
+			seconds := int64(timestamp)
+			nanos := int64((timestamp - float64(seconds)) * float64(time.Second))
+			return time.Unix(seconds, nanos), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// unixTimestamp returns a decoded timestamp value as Unix seconds; JSON
+// decodes numbers as float64, msgpack as whichever sized type fits
+func unixTimestamp(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// ReplyStatus classifies a worker's reply to a control command
+type ReplyStatus int
+
+const (
+	// ReplyUnknown is a reply whose shape is not recognized
+	ReplyUnknown ReplyStatus = iota
+	// ReplyOK is a successful reply, e.g. {"worker@host": {"ok": "pong"}}
+	ReplyOK
+	// ReplyError is an error reply, e.g. {"worker@host": {"error": "..."}}
+	ReplyError
+)
+
+// String returns a human readable name for the reply status
+func (s ReplyStatus) String() string {
+	switch s {
+	case ReplyOK:
+		return "ok"
+	case ReplyError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// WorkerReply is the typed form of a single worker's reply
+type WorkerReply struct {
+	WorkerName string
+	Status     ReplyStatus
+	// OK holds the value of the "ok" field for successful replies
+	OK string
+	// Error holds the value of the "error" field for error replies
+	Error string
+	// Meta holds any other fields the worker included in its reply
+	// (e.g. sw_ver, pool); nil when the reply carried only ok/error
+	Meta map[string]interface{}
+}
+
 // WorkerInfo represents information about a Celery worker
 type WorkerInfo struct {
 	Hostname  string    `json:"hostname"`
@@ -51,6 +140,58 @@ type WorkerInfo struct {
 	Active    bool      `json:"active"`
 	Processed int       `json:"processed"`
 	LoadAvg   []float64 `json:"loadavg,omitempty"`
+
+	// Process and software details, when the worker reports them
+	PID     int    `json:"pid,omitempty"`
+	SWIdent string `json:"sw_ident,omitempty"`
+	SWVer   string `json:"sw_ver,omitempty"`
+	SWSys   string `json:"sw_sys,omitempty"`
+
+	// Pool size: Concurrency is the pool's max-concurrency and Processes
+	// the number of pool processes (prefork only)
+	Concurrency int `json:"concurrency,omitempty"`
+	Processes   int `json:"processes,omitempty"`
+}
+
+// workerStats is the part of a Celery "stats" reply ParseWorkerInfo reads
+type workerStats struct {
+	PID     int            `json:"pid"`
+	SWIdent string         `json:"sw_ident"`
+	SWVer   string         `json:"sw_ver"`
+	SWSys   string         `json:"sw_sys"`
+	Total   map[string]int `json:"total"`
+	LoadAvg []float64      `json:"loadavg"`
+	Pool    struct {
+		MaxConcurrency int   `json:"max-concurrency"`
+		Processes      []int `json:"processes"`
+	} `json:"pool"`
+}
+
+// ParseWorkerInfo extracts the common fields of a worker's inspect reply
+// (e.g. "stats"). Processed is the sum of the per-task "total" counters and
+// Active is set because the worker answered; absent fields stay zero.
+func ParseWorkerInfo(hostname string, reply json.RawMessage) (WorkerInfo, error) {
+	var fields workerStats
+	if err := json.Unmarshal(reply, &fields); err != nil {
+		return WorkerInfo{}, fmt.Errorf("failed to parse reply from %s: %w", hostname, err)
+	}
+
+	info := WorkerInfo{
+		Hostname: hostname,
+		Active:   true,
+		LoadAvg:  fields.LoadAvg,
+		PID:      fields.PID,
+		SWIdent:  fields.SWIdent,
+		SWVer:    fields.SWVer,
+		SWSys:    fields.SWSys,
+
+		Concurrency: fields.Pool.MaxConcurrency,
+		Processes:   len(fields.Pool.Processes),
+	}
+	for _, count := range fields.Total {
+		info.Processed += count
+	}
+	return info, nil
 }
 
 // ParsePingResponse parses a JSON response into a PingResponse
@@ -2,6 +2,7 @@ package protocol
 
 import (
 	"encoding/json"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -336,3 +337,138 @@ func TestCeleryMessage_JSON_Serialization(t *testing.T) {
 		t.Errorf("Expected delivery mode %d, got %d", msg.Properties.DeliveryMode, parsed.Properties.DeliveryMode)
 	}
 }
+
+func TestParseWorkerInfo(t *testing.T) {
+	tests := []struct {
+		name     string
+		reply    string
+		expected WorkerInfo
+		wantErr  bool
+	}{
+		{
+			name:  "stats reply",
+			reply: `{"pid": 4242, "total": {"tasks.add": 10, "tasks.mul": 5}, "pool": {"max-concurrency": 4}}`,
+			expected: WorkerInfo{
+				Hostname:    "celery@host",
+				Active:      true,
+				Processed:   15,
+				PID:         4242,
+				Concurrency: 4,
+			},
+		},
+		{
+			name: "prefork pool",
+			reply: `{"pid": 4242, "pool": {"implementation": "celery.concurrency.prefork:TaskPool",
+				"max-concurrency": 4, "processes": [4243, 4244, 4245, 4246], "put-guarded-by-semaphore": false,
+				"timeouts": [0, 0], "writes": {"total": 12, "avg": "0.25", "all": "0.25, 0.25, 0.25, 0.25"}},
+				"rusage": {"utime": 1.5, "maxrss": 52000}, "prefetch_count": 16}`,
+			expected: WorkerInfo{
+				Hostname:    "celery@host",
+				Active:      true,
+				PID:         4242,
+				Concurrency: 4,
+				Processes:   4,
+			},
+		},
+		{
+			name:    "mistyped pool",
+			reply:   `{"pool": {"max-concurrency": "4"}}`,
+			wantErr: true,
+		},
+		{
+			name:  "software and load fields",
+			reply: `{"pid": 7, "sw_ident": "py-celery", "sw_ver": "5.3.6", "sw_sys": "Linux", "loadavg": [0.5, 0.25, 0.1]}`,
+			expected: WorkerInfo{
+				Hostname: "celery@host",
+				Active:   true,
+				LoadAvg:  []float64{0.5, 0.25, 0.1},
+				PID:      7,
+				SWIdent:  "py-celery",
+				SWVer:    "5.3.6",
+				SWSys:    "Linux",
+			},
+		},
+		{
+			name:     "no known fields",
+			reply:    `{"ok": "pong"}`,
+			expected: WorkerInfo{Hostname: "celery@host", Active: true},
+		},
+		{
+			name:    "not an object",
+			reply:   `"pong"`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := ParseWorkerInfo("celery@host", json.RawMessage(tt.reply))
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(info, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, info)
+			}
+		})
+	}
+}
+
+func TestReplyTimestamp(t *testing.T) {
+	tests := []struct {
+		name     string
+		response map[string]interface{}
+		expected time.Time
+		ok       bool
+	}{
+		{
+			name:     "plain pong has no timestamp",
+			response: map[string]interface{}{"w1@h": map[string]interface{}{"ok": "pong"}},
+		},
+		{
+			name: "top-level timestamp",
+			response: map[string]interface{}{
+				"hostname":  "w1@h",
+				"timestamp": 1700000000.5,
+			},
+			expected: time.Unix(1700000000, 5e8),
+			ok:       true,
+		},
+		{
+			name: "timestamp in the worker entry",
+			response: map[string]interface{}{
+				"w1@h": map[string]interface{}{"ok": "pong", "timestamp": 1700000002.0},
+			},
+			expected: time.Unix(1700000002, 0),
+			ok:       true,
+		},
+		{
+			name: "integer timestamp from a msgpack body",
+			response: map[string]interface{}{
+				"w1@h": map[string]interface{}{"ok": "pong", "timestamp": uint32(1700000003)},
+			},
+			expected: time.Unix(1700000003, 0),
+			ok:       true,
+		},
+		{
+			name: "non-numeric timestamp is ignored",
+			response: map[string]interface{}{
+				"w1@h": map[string]interface{}{"ok": "pong", "timestamp": "yesterday"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ReplyTimestamp(tt.response, "w1@h")
+			if ok != tt.ok || !got.Equal(tt.expected) {
+				t.Errorf("Expected (%v, %v), got (%v, %v)", tt.expected, tt.ok, got, ok)
+			}
+		})
+	}
+}
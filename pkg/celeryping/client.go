@@ -0,0 +1,118 @@
+// Package celeryping pings Celery workers from Go programs. It is the
+// library counterpart of the fast-celery-ping command.
+package celeryping
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"fast-celery-ping/internal/broker"
+	"fast-celery-ping/internal/config"
+)
+
+// Reply is one worker's answer to a ping
+type Reply = broker.PingResponse
+
+// Errors returned by New, Ping and Healthy can be told apart with errors.Is
+var (
+	// ErrNotConnected means the client has no usable broker connection
+	ErrNotConnected = broker.ErrNotConnected
+	// ErrConnectFailed means New could not reach the broker
+	ErrConnectFailed = broker.ErrConnectFailed
+	// ErrAuthFailed means the broker rejected the credentials; such errors
+	// are ErrConnectFailed too
+	ErrAuthFailed = broker.ErrAuthFailed
+	// ErrPublishFailed means the ping could not be sent
+	ErrPublishFailed = broker.ErrPublishFailed
+)
+
+// ParseError is a worker reply that could not be decoded; use errors.As
+type ParseError = broker.ParseError
+
+// Defaults applied to zero Options fields, matching the command's defaults
+const (
+	DefaultTimeout        = time.Second * 15 / 10 // 1.5 seconds
+	DefaultConnectTimeout = 3 * time.Second
+)
+
+// pingGracePeriod is added on top of the ping timeout so that publishing
+// and reply-queue cleanup are not cut short by the collection deadline
+const pingGracePeriod = time.Second
+
+// Options configures a Client; zero values keep the defaults
+type Options struct {
+	// BrokerURL is a redis://, rediss://, unix://, amqp:// or amqps:// URL
+	BrokerURL string
+	Username  string
+	Password  string
+
+	// Timeout bounds how long each Ping collects replies
+	Timeout time.Duration
+	// ConnectTimeout bounds establishing the connection in New
+	ConnectTimeout time.Duration
+}
+
+// Client pings workers over a single broker connection, opened by New and
+// reused by every Ping until Close. A Client is safe for sequential use
+// only; do not call its methods from several goroutines at once.
+type Client struct {
+	broker  broker.Broker
+	timeout time.Duration
+}
+
+// New connects to the broker and returns a Client ready to ping
+func New(ctx context.Context, opts Options) (*Client, error) {
+	if opts.BrokerURL == "" {
+		return nil, fmt.Errorf("broker URL is required")
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.ConnectTimeout == 0 {
+		opts.ConnectTimeout = DefaultConnectTimeout
+	}
+
+	b, err := broker.NewBroker(config.DetectBrokerType(opts.BrokerURL), broker.Config{
+		URL:        opts.BrokerURL,
+		Username:   opts.Username,
+		Password:   opts.Password,
+		Timeout:    opts.Timeout,
+		MaxWorkers: 10,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create broker: %w", err)
+	}
+
+	return connect(ctx, b, opts)
+}
+
+// connect opens b within the connect timeout and wraps it in a Client
+func connect(ctx context.Context, b broker.Broker, opts Options) (*Client, error) {
+	connectCtx, cancel := context.WithTimeout(ctx, opts.ConnectTimeout)
+	defer cancel()
+
+	if err := b.Connect(connectCtx); err != nil {
+		return nil, fmt.Errorf("failed to connect to broker: %w", err)
+	}
+	return &Client{broker: b, timeout: opts.Timeout}, nil
+}
+
+// Ping broadcasts a ping, or targets destinations if given, and returns the
+// replies keyed by worker name
+func (c *Client) Ping(ctx context.Context, destinations ...string) (map[string]Reply, error) {
+	pingCtx, cancel := context.WithTimeout(ctx, c.timeout+pingGracePeriod)
+	defer cancel()
+
+	return c.broker.Ping(pingCtx, c.timeout, destinations)
+}
+
+// Healthy checks that the broker connection is still usable
+func (c *Client) Healthy(ctx context.Context) error {
+	return c.broker.Health(ctx)
+}
+
+// Close tears down the broker connection
+func (c *Client) Close() error {
+	return c.broker.Close()
+}
@@ -0,0 +1,87 @@
+package celeryping
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"fast-celery-ping/internal/broker"
+)
+
+// countingBroker counts connections made to the wrapped mock broker
+type countingBroker struct {
+	*broker.MockBroker
+	connects int
+	closed   bool
+}
+
+func (b *countingBroker) Connect(ctx context.Context) error {
+	b.connects++
+	return b.MockBroker.Connect(ctx)
+}
+
+func (b *countingBroker) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestClient_PingReusesConnection(t *testing.T) {
+	mock := &countingBroker{MockBroker: broker.NewMockBroker(map[string]broker.PingResponse{
+		"worker1@host": {WorkerName: "worker1@host", Status: "pong"},
+		"worker2@host": {WorkerName: "worker2@host", Status: "pong"},
+	})}
+
+	client, err := connect(context.Background(), mock, Options{Timeout: time.Second, ConnectTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		replies, err := client.Ping(context.Background())
+		if err != nil {
+			t.Fatalf("Ping %d failed: %v", i+1, err)
+		}
+		if len(replies) != 2 {
+			t.Errorf("Ping %d: expected 2 replies, got %v", i+1, replies)
+		}
+	}
+
+	if replies, err := client.Ping(context.Background(), "worker2@host"); err != nil || len(replies) != 1 {
+		t.Errorf("Expected one targeted reply, got %v (%v)", replies, err)
+	}
+
+	if err := client.Healthy(context.Background()); err != nil {
+		t.Errorf("Expected healthy client, got %v", err)
+	}
+	if err := client.Close(); err != nil {
+		t.Errorf("Unexpected close error: %v", err)
+	}
+
+	if mock.connects != 1 {
+		t.Errorf("Expected a single connect, got %d", mock.connects)
+	}
+	if mock.Calls() != 3 {
+		t.Errorf("Expected 3 pings, got %d", mock.Calls())
+	}
+	if !mock.closed {
+		t.Error("Expected Close to close the broker")
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	if _, err := New(context.Background(), Options{}); err == nil {
+		t.Error("Expected error without broker URL")
+	}
+
+	mock := &countingBroker{MockBroker: &broker.MockBroker{ConnectErr: errors.New("refused")}}
+	if _, err := connect(context.Background(), mock, Options{ConnectTimeout: time.Second}); err == nil {
+		t.Error("Expected connect error")
+	}
+
+	// Nothing listens on port 1, so connecting fails with a typed error
+	_, err := New(context.Background(), Options{BrokerURL: "redis://127.0.0.1:1/0", ConnectTimeout: time.Second})
+	if !errors.Is(err, ErrConnectFailed) {
+		t.Errorf("Expected ErrConnectFailed, got %v", err)
+	}
+}